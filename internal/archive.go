@@ -0,0 +1,143 @@
+package internal
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+var archiveExtensions = []string{".tar", ".tar.gz", ".tgz", ".zip"}
+
+func cutArchiveSource(source string) (string, string, bool) {
+	// Split the member path inside the archive from the archive path.
+	archivePath, member, _ := strings.Cut(source, "//")
+	for _, ext := range archiveExtensions {
+		if strings.HasSuffix(archivePath, ext) {
+			return archivePath, member, true
+		}
+	}
+
+	return "", "", false
+}
+
+func newArchiveFs(fs afero.Fs, name string) (afero.Fs, error) {
+	// Read the archive.
+	b, err := afero.ReadFile(fs, name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Extract the archive into memory.
+	archiveFs := afero.NewMemMapFs()
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		err = extractZip(archiveFs, b)
+	case strings.HasSuffix(name, ".tar"):
+		err = extractTar(archiveFs, bytes.NewReader(b))
+	default:
+		var r *gzip.Reader
+		r, err = gzip.NewReader(bytes.NewReader(b))
+		if err == nil {
+			err = extractTar(archiveFs, r)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrMountInvalid, name, err)
+	}
+
+	return afero.NewReadOnlyFs(archiveFs), nil
+}
+
+func extractTar(fs afero.Fs, r io.Reader) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		// Only regular files and directories are extracted.
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = fs.MkdirAll(archiveMemberPath(header.Name), 0755)
+		case tar.TypeReg:
+			err = writeArchiveMember(fs, header.Name, tr)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func extractZip(fs afero.Fs, b []byte) error {
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return err
+	}
+
+	for _, f := range zr.File {
+		// Directories end with a separator.
+		if strings.HasSuffix(f.Name, "/") {
+			if err := fs.MkdirAll(archiveMemberPath(f.Name), 0755); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Only regular files are extracted.
+		if !f.Mode().IsRegular() {
+			continue
+		}
+
+		r, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = writeArchiveMember(fs, f.Name, r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeArchiveMember(fs afero.Fs, name string, r io.Reader) error {
+	// Create the parent directories, which archives may omit.
+	p := archiveMemberPath(name)
+	if err := fs.MkdirAll(path.Dir(p), 0755); err != nil {
+		return err
+	}
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	return afero.WriteFile(fs, p, b, 0644)
+}
+
+func archiveSourcePath(member string) string {
+	// The root of an archive is mounted like a directory with a separator.
+	p := archiveMemberPath(member)
+	if member == "" || strings.HasSuffix(member, "/") {
+		return appendPathSeparator(strings.TrimSuffix(p, "/"))
+	}
+
+	return p
+}
+
+func archiveMemberPath(name string) string {
+	// Cleaning a rooted path keeps members inside the archive.
+	return path.Clean("/" + name)
+}
@@ -0,0 +1,122 @@
+package internal
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testArchiveFiles = map[string]string{
+	"lib/a.tmpl":   "a",
+	"lib/b/c.tmpl": "c",
+	"README.md":    "readme",
+}
+
+func writeTestTar(t *testing.T, fs afero.Fs, name string, gzipped bool) {
+	var buf bytes.Buffer
+	var gw *gzip.Writer
+	tw := tar.NewWriter(&buf)
+	if gzipped {
+		gw = gzip.NewWriter(&buf)
+		tw = tar.NewWriter(gw)
+	}
+
+	// Omit the directory entries, like some archivers do.
+	for _, member := range sortedKeys(testArchiveFiles) {
+		content := testArchiveFiles[member]
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: member, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	if gw != nil {
+		require.NoError(t, gw.Close())
+	}
+
+	require.NoError(t, afero.WriteFile(fs, name, buf.Bytes(), 0644))
+}
+
+func writeTestZip(t *testing.T, fs afero.Fs, name string) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	_, err := zw.Create("lib/")
+	require.NoError(t, err)
+	for _, member := range sortedKeys(testArchiveFiles) {
+		w, err := zw.Create(member)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(testArchiveFiles[member]))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+
+	require.NoError(t, afero.WriteFile(fs, name, buf.Bytes(), 0644))
+}
+
+func TestMountWhenArchive(t *testing.T) {
+	t.Parallel()
+
+	th := NewTestHarness(t, afero.NewMemMapFs())
+	dir := th.TempDir()
+	writeTestTar(t, th.fs, path.Join(dir, "lib.tar"), false)
+	writeTestTar(t, th.fs, path.Join(dir, "lib.tar.gz"), true)
+	writeTestTar(t, th.fs, path.Join(dir, "lib.tgz"), true)
+	writeTestZip(t, th.fs, path.Join(dir, "lib.zip"))
+
+	for _, name := range []string{"lib.tar", "lib.tar.gz", "lib.tgz", "lib.zip"} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Mount the whole archive.
+			m := th.NewMount(path.Join(dir, name) + ":/target")
+			var files []string
+			require.NoError(t, m.Files("/target/*/*", &files, nil))
+			assert.Equal(t, []string{"/target/lib/a.tmpl"}, files)
+			var dirs []string
+			require.NoError(t, m.Dirs("/target/lib/*", &dirs, nil))
+			assert.Equal(t, []string{"/target/lib/b"}, dirs)
+
+			// Mount a directory of the archive.
+			m = th.NewMount(path.Join(dir, name) + "//lib:/lib")
+			s, err := m.ReadFileString("/lib/b/c.tmpl")
+			require.NoError(t, err)
+			assert.Equal(t, "c", s)
+
+			// Mount a file of the archive.
+			m = th.NewMount(path.Join(dir, name) + "//lib/a.tmpl:/a.tmpl")
+			s, err = m.ReadFileString("/a.tmpl")
+			require.NoError(t, err)
+			assert.Equal(t, "a", s)
+		})
+	}
+}
+
+func TestMountWhenArchiveMemberMissing(t *testing.T) {
+	t.Parallel()
+
+	th := NewTestHarness(t, afero.NewMemMapFs())
+	archive := path.Join(th.TempDir(), "lib.tar.gz")
+	writeTestTar(t, th.fs, archive, true)
+
+	err := th.NewMountExpectingError(archive + "//missing:/lib")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.EqualError(t, err, "file does not exist: "+archive+"!missing")
+}
+
+func TestMountWhenArchiveInvalid(t *testing.T) {
+	t.Parallel()
+
+	th := NewTestHarness(t, afero.NewMemMapFs())
+	archive := path.Join(th.TempDir(), "lib.tar.gz")
+	th.WriteFileString(archive, "not an archive")
+
+	err := th.NewMountExpectingError(archive + ":/lib")
+	assert.ErrorIs(t, err, ErrMountInvalid)
+}
@@ -1,64 +1,562 @@
 package internal
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/bmatcuk/doublestar/v4"
 	"github.com/spf13/afero"
 	"gopkg.in/yaml.v3"
 )
 
+const stdinName = "-"
+
+var configNamespaceRegexp = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*(?:\.[A-Za-z_][A-Za-z0-9_]*)*)=(.+)$`)
+
 type ConfigSpecData struct {
-	Config map[string]any `yaml:"Config"`
+	SchemaVersion int                  `yaml:"SchemaVersion"`
+	Imports       []string             `yaml:"Imports"`
+	Config        ConfigMap            `yaml:"Config"`
+	Profiles      map[string]ConfigMap `yaml:"Profiles"`
 }
 
 type ConfigSpec struct {
-	fs     afero.Fs
-	config map[string]any
+	fs           afero.Fs
+	mounts       Mounts
+	options      Options
+	config       map[string]any
+	provenance   map[string][]string
+	profiles     map[string]bool
+	migrations   *ConfigMigrations
+	dependencies []string
+	secretKey    []byte
+	secrets      []string
+	warnings     []ConfigWarning
+}
+
+type ConfigWarning struct {
+	File    string
+	Line    int
+	Message string
 }
 
-func NewConfigSpec(fs afero.Fs, names []string) (*ConfigSpec, error) {
+type ConfigSource struct {
+	Key   string
+	Value any
+	Files []string
+}
+
+func NewConfigSpec(fs afero.Fs, mounts Mounts, names []string, opts Options) (*ConfigSpec, error) {
 	configSpec := &ConfigSpec{
-		fs:     fs,
-		config: make(map[string]any),
+		fs:         fs,
+		mounts:     mounts,
+		options:    opts,
+		config:     make(map[string]any),
+		provenance: make(map[string][]string),
+		profiles:   make(map[string]bool),
 	}
 
+	// Load the migrations of renamed and removed keys.
+	migrations, err := LoadMountedConfigMigrations(fs, mounts, opts.ConfigMigrations, opts.Lock)
+	if err != nil {
+		return nil, err
+	}
+	configSpec.migrations = migrations
+
 	for _, name := range names {
-		err := configSpec.Merge(name)
+		err := configSpec.Load(name)
 		if err != nil {
-			return nil, err
+			return nil, configSpec.RedactError(err)
+		}
+	}
+
+	// Check that the selected profiles are defined by at least one file.
+	for _, profile := range opts.Profiles {
+		if !configSpec.profiles[profile] {
+			return nil, fmt.Errorf("%w: %s", ErrConfigProfileUnknown, profile)
 		}
 	}
 
+	// Apply the patches after the ordinary files.
+	for _, name := range opts.ConfigPatches {
+		err := configSpec.Patch(name)
+		if err != nil {
+			return nil, configSpec.RedactError(err)
+		}
+	}
+
+	// Resolve references between keys now that all the files are merged.
+	config, err := interpolate(configSpec.config)
+	if err != nil {
+		return nil, configSpec.RedactError(err)
+	}
+	configSpec.config = config
+
 	return configSpec, nil
 }
 
+func (c *ConfigSpec) Load(spec string) error {
+	// Place the file contents under a namespace when one is given.
+	namespace, name, ok := splitConfigNamespace(spec)
+
+	// Read stdin as a single file.
+	if name == stdinName {
+		if ok {
+			return c.MergeNamespace(namespace, name)
+		}
+		return c.Merge(name)
+	}
+
+	// Check if the config is a directory.
+	info, err := c.fs.Stat(name)
+	if err != nil {
+		return err
+	}
+
+	// Load a single file.
+	if !info.IsDir() {
+		if ok {
+			return c.MergeNamespace(namespace, name)
+		}
+		return c.Merge(name)
+	}
+
+	// Load the YAML files in the directory in name order.
+	names, err := listConfigFiles(c.fs, name)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if ok {
+			base := filepath.Base(name)
+			err = c.MergeNamespace(joinKeyPath(namespace, strings.TrimSuffix(base, filepath.Ext(base))), name)
+		} else {
+			err = c.Merge(name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (c *ConfigSpec) Merge(name string) error {
+	return c.merge(name, nil)
+}
+
+func (c *ConfigSpec) MergeNamespace(namespace string, name string) error {
+	// Read the file at the given path.
+	docs, err := c.readDocuments(name)
+	if err != nil {
+		return err
+	}
+
+	// Decode the whole documents since they do not need a Config element.
+	var data any
+	for _, doc := range docs {
+		v, err := decodeConfigNode(doc.node)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+
+		// Merge maps from later documents, otherwise replace the value.
+		if a, ok := data.(map[string]any); ok {
+			if b, ok := v.(map[string]any); ok {
+				data = mergeMaps(a, b)
+				continue
+			}
+		}
+		data = v
+	}
+
+	// Replace any value under the namespace.
+	keys := splitKeyPath(namespace)
+	c.config = setKeyPath(c.config, keys, data)
+	c.forget(namespace)
+	if m, ok := data.(map[string]any); ok && len(m) > 0 {
+		c.record(namespace, m, []string{name})
+	} else {
+		c.provenance[namespace] = []string{name}
+	}
+
+	// Success.
+	return nil
+}
+
+func (c *ConfigSpec) merge(name string, chain []string) error {
+	// Check for an import cycle.
+	absName, err := filepath.Abs(name)
+	if err != nil {
+		return err
+	}
+	for i, imported := range chain {
+		if absImported, err := filepath.Abs(imported); err == nil && absImported == absName {
+			cycle := append(slices.Clone(chain[i:]), name)
+			return fmt.Errorf("%w: %s", ErrConfigCycle, strings.Join(cycle, " -> "))
+		}
+	}
+	chain = append(slices.Clone(chain), name)
+
 	// Read the file at the given path
-	b, err := afero.ReadFile(c.fs, name)
+	docs, err := c.readDocuments(name)
 	if err != nil {
 		return err
 	}
 
-	// Unmarshal the YAML data into a map
+	// Check that the file is not empty.
+	if len(docs) == 0 {
+		return fmt.Errorf("%w: %s: required field '%s' not found", ErrConfigInvalid, name, "Config")
+	}
+
+	// Merge each document in order.
+	for _, doc := range docs {
+		if err := c.mergeDocument(name, doc, chain); err != nil {
+			return err
+		}
+	}
+
+	// Success
+	return nil
+}
+
+func (c *ConfigSpec) mergeDocument(name string, doc *configDocument, chain []string) error {
+	// Rewrite renamed and removed keys.
+	if err := c.migrate(name, doc); err != nil {
+		return err
+	}
+
+	// Decode the YAML document into a map
 	var data ConfigSpecData
-	err = yaml.Unmarshal(b, &data)
+	err := doc.node.Decode(&data)
 	if err != nil {
-		return err
+		return fmt.Errorf("%s: %w", name, err)
 	}
 
 	// Check that the required Config element is present
-	if data.Config == nil {
+	if data.Config == nil && len(data.Imports) == 0 && len(data.Profiles) == 0 {
 		return fmt.Errorf("%w: required field '%s' not found", ErrConfigInvalid, "Config")
 	}
 
+	// Merge the imported files before the file's own config so that it can
+	// override the imported values.
+	for _, pattern := range data.Imports {
+		names, err := c.resolveImport(name, pattern)
+		if err != nil {
+			return err
+		}
+
+		for _, imported := range names {
+			if err := c.merge(imported, chain); err != nil {
+				return err
+			}
+		}
+	}
+
 	// Merge the maps.
-	c.config = mergeMaps(c.config, data.Config)
+	if err := c.mergeConfig(name, doc, "Config", data.Config); err != nil {
+		return err
+	}
+	c.record("", data.Config, chain)
+
+	// Overlay the selected profiles in order.
+	for profile := range data.Profiles {
+		c.profiles[profile] = true
+	}
+	for _, profile := range c.options.Profiles {
+		if config, ok := data.Profiles[profile]; ok {
+			if err := c.mergeConfig(name, doc, joinKeyPath("Profiles", profile), config); err != nil {
+				return err
+			}
+			c.record("", config, append(slices.Clone(chain[:len(chain)-1]), fmt.Sprintf("%s (profile %s)", name, profile)))
+		}
+	}
 
 	// Success
 	return nil
 }
 
+func (c *ConfigSpec) mergeConfig(name string, doc *configDocument, docKeyPath string, config map[string]any) error {
+	// Report values that change type since templates usually expect one type.
+	merged, err := mergeMapsFunc(c.config, config, "", func(keyPath string, a, b any) error {
+		docPath := joinKeyPath(docKeyPath, keyPath)
+		return c.warn(name, doc.line(docPath), "%s: type conflict: %s replaced by %s", docPath, configTypeName(a), configTypeName(b))
+	})
+	if err != nil {
+		return err
+	}
+
+	c.config = merged
+	return nil
+}
+
+func (c *ConfigSpec) warn(name string, line int, format string, args ...any) error {
+	warning := ConfigWarning{
+		File:    name,
+		Line:    line,
+		Message: fmt.Sprintf(format, args...),
+	}
+
+	// Fail instead of warning in strict mode.
+	if c.options.StrictConfig {
+		return fmt.Errorf("%w: %s", ErrConfigStrict, warning)
+	}
+
+	c.warnings = append(c.warnings, warning)
+	return nil
+}
+
+func (c *ConfigSpec) Warnings() []ConfigWarning {
+	return slices.Clone(c.warnings)
+}
+
+func (c *ConfigSpec) readDocuments(name string) ([]*configDocument, error) {
+	// Read the file at the given path
+	b, err := c.readFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Render config templates with the config merged so far.
+	b, header := cutConfigTemplateHeader(b)
+	if header || isConfigTemplate(name) {
+		b, err = c.render(name, b)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return c.parseDocuments(name, b, c.readHostFile)
+}
+
+func (c *ConfigSpec) parseDocuments(name string, b []byte, readFile func(string) ([]byte, error)) ([]*configDocument, error) {
+	// Parse each of the YAML documents.
+	var docs []*configDocument
+	decoder := yaml.NewDecoder(bytes.NewReader(b))
+	for {
+		var doc yaml.Node
+		err := decoder.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		// Skip empty documents.
+		if len(doc.Content) == 0 || doc.Content[0].ShortTag() == "!!null" {
+			continue
+		}
+
+		// Resolve the custom tags.
+		if err := c.resolveTags(name, &doc, []string{filepath.Clean(name)}, readFile); err != nil {
+			return nil, err
+		}
+
+		// Decrypt the secret values.
+		if err := c.decryptSecrets(&doc); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		// Check for ambiguous values and remember the line of each key.
+		lines := make(map[string]int)
+		if err := c.inspect(name, "", &doc, lines); err != nil {
+			return nil, err
+		}
+
+		docs = append(docs, &configDocument{&doc, lines})
+	}
+
+	return docs, nil
+}
+
+func (c *ConfigSpec) readFile(name string) ([]byte, error) {
+	// Read from stdin when the name is a dash.
+	if name == stdinName {
+		stdin := c.options.Stdin
+		if stdin == nil {
+			stdin = os.Stdin
+		}
+		return io.ReadAll(stdin)
+	}
+
+	return afero.ReadFile(c.fs, name)
+}
+
+func (c *ConfigSpec) readHostFile(name string) ([]byte, error) {
+	return afero.ReadFile(c.fs, name)
+}
+
+func (c *ConfigSpec) resolveImport(name string, pattern string) ([]string, error) {
+	// Imports are relative to the importing file.
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(filepath.Dir(name), pattern)
+	}
+
+	// Import exactly one file when the pattern is not a glob.
+	if !strings.ContainsAny(pattern, `*?[{\`) {
+		return []string{pattern}, nil
+	}
+
+	// Match the pattern below the directory that does not contain a glob.
+	base, rest := doublestar.SplitPattern(filepath.ToSlash(pattern))
+	root, err := filepath.Abs(base)
+	if err != nil {
+		return nil, err
+	}
+	matches, err := doublestar.Glob(afero.NewIOFS(afero.NewBasePathFs(c.fs, root)), rest, doublestar.WithFilesOnly())
+	if err != nil {
+		return nil, fmt.Errorf("%w: import '%s': %w", ErrConfigInvalid, pattern, err)
+	}
+
+	// Import the matching files in a predictable order.
+	names := make([]string, 0, len(matches))
+	for _, match := range matches {
+		names = append(names, filepath.Join(base, match))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (c *ConfigSpec) record(keyPath string, config map[string]any, chain []string) {
+	for k, v := range config {
+		childPath := joinKeyPath(keyPath, k)
+
+		// Nested maps are merged, so record their keys individually.
+		if m, ok := v.(map[string]any); ok && len(m) > 0 {
+			delete(c.provenance, childPath)
+			c.record(childPath, m, chain)
+			continue
+		}
+
+		// Forget the sources of nested keys that were replaced by this value.
+		c.forget(childPath)
+		c.provenance[childPath] = chain
+	}
+}
+
+func (c *ConfigSpec) forget(keyPath string) {
+	delete(c.provenance, keyPath)
+	for key := range c.provenance {
+		if strings.HasPrefix(key, keyPath+".") {
+			delete(c.provenance, key)
+		}
+	}
+}
+
+func (c *ConfigSpec) Sources() []ConfigSource {
+	var sources []ConfigSource
+	for key, files := range c.provenance {
+		value, _ := lookupKeyPath(c.config, splitKeyPath(key))
+		sources = append(sources, ConfigSource{
+			Key:   key,
+			Value: c.redactValue(value),
+			Files: slices.Clone(files),
+		})
+	}
+
+	// Sort by key for predictable output.
+	sort.Slice(sources, func(i, j int) bool {
+		return sources[i].Key < sources[j].Key
+	})
+
+	return sources
+}
+
+func (s ConfigSource) String() string {
+	var sb strings.Builder
+	sb.WriteString(s.Key + ": " + formatConfigValue(s.Value))
+	for i := len(s.Files) - 1; i >= 0; i-- {
+		if i == len(s.Files)-1 {
+			sb.WriteString("\n  set in " + s.Files[i])
+		} else {
+			sb.WriteString("\n  imported by " + s.Files[i])
+		}
+	}
+	return sb.String()
+}
+
+func (w ConfigWarning) String() string {
+	if w.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", w.File, w.Line, w.Message)
+	}
+
+	return fmt.Sprintf("%s: %s", w.File, w.Message)
+}
+
+func configTypeName(v any) string {
+	switch v.(type) {
+	case map[string]any:
+		return "map"
+	case []any:
+		return "list"
+	case string:
+		return "string"
+	case int, uint64:
+		return "int"
+	case float64:
+		return "float"
+	case bool:
+		return "bool"
+	case time.Time:
+		return "timestamp"
+	case []byte:
+		return "binary"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func formatConfigValue(v any) string {
+	if s, ok := v.(string); ok {
+		return strconv.Quote(s)
+	}
+
+	return fmt.Sprint(v)
+}
+
+func splitConfigNamespace(spec string) (string, string, bool) {
+	if m := configNamespaceRegexp.FindStringSubmatch(spec); m != nil {
+		return m[1], m[2], true
+	}
+
+	return "", spec, false
+}
+
+func listConfigFiles(fs afero.Fs, dir string) ([]string, error) {
+	entries, err := afero.ReadDir(fs, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// Entries are already sorted by name.
+	var names []string
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if !entry.IsDir() && (ext == ".yml" || ext == ".yaml") {
+			names = append(names, filepath.Join(dir, entry.Name()))
+		}
+	}
+
+	return names, nil
+}
+
 func mergeMaps(a, b map[string]any) map[string]any {
+	out, _ := mergeMapsFunc(a, b, "", nil)
+	return out
+}
+
+func mergeMapsFunc(a, b map[string]any, keyPath string, conflict func(keyPath string, a, b any) error) (map[string]any, error) {
 	out := make(map[string]any, len(a))
 	for k, v := range a {
 		out[k] = v
@@ -67,12 +565,21 @@ func mergeMaps(a, b map[string]any) map[string]any {
 		if v, ok := v.(map[string]any); ok {
 			if bv, ok := out[k]; ok {
 				if bv, ok := bv.(map[string]any); ok {
-					out[k] = mergeMaps(bv, v)
+					merged, err := mergeMapsFunc(bv, v, joinKeyPath(keyPath, k), conflict)
+					if err != nil {
+						return nil, err
+					}
+					out[k] = merged
 					continue
 				}
 			}
 		}
+		if bv, ok := out[k]; ok && bv != nil && v != nil && conflict != nil && configTypeName(bv) != configTypeName(v) {
+			if err := conflict(joinKeyPath(keyPath, k), bv, v); err != nil {
+				return nil, err
+			}
+		}
 		out[k] = v
 	}
-	return out
+	return out, nil
 }
@@ -0,0 +1,410 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v3"
+)
+
+func SetConfigValue(fs afero.Fs, name string, keyPath string, value string) error {
+	// Parse the value as YAML so that it has the expected type.
+	var valueDoc yaml.Node
+	if err := yaml.Unmarshal([]byte(value), &valueDoc); err != nil {
+		return fmt.Errorf("%w: value: %w", ErrConfigInvalid, err)
+	}
+	valueNode := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}
+	if len(valueDoc.Content) > 0 {
+		valueNode = valueDoc.Content[0]
+	}
+
+	// Write numbers that would change when parsed as strings, e.g. versions
+	// like 1.20 that would become 1.2.
+	if isChangedNumber(valueNode) {
+		valueNode = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: valueNode.Value}
+	}
+
+	// Replace an existing value in place so that the rest of the file is
+	// unchanged.
+	keys := splitKeyPath(keyPath)
+	if ok, err := spliceConfigValue(fs, name, keys, valueNode); err != nil || ok {
+		return err
+	}
+
+	return editConfigFile(fs, name, func(docs []*yaml.Node) ([]*yaml.Node, error) {
+		// Edit the last document that sets the key since it takes precedence
+		// over the earlier documents. Otherwise, edit the first document.
+		doc := lastConfigDocument(docs, keys)
+		if doc == nil {
+			if len(docs) == 0 {
+				docs = append(docs, &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}})
+			}
+			doc = docs[0]
+		}
+
+		return docs, setConfigNode(doc.Content[0], keys, keyPath, valueNode)
+	})
+}
+
+func UnsetConfigValue(fs afero.Fs, name string, keyPath string) error {
+	return editConfigFile(fs, name, func(docs []*yaml.Node) ([]*yaml.Node, error) {
+		keys := splitKeyPath(keyPath)
+
+		// Remove the key from every document.
+		found := false
+		for _, doc := range docs {
+			parent, ok := findConfigNode(doc, keys[:len(keys)-1])
+			if !ok || parent.Kind != yaml.MappingNode {
+				continue
+			}
+
+			for i := 0; i+1 < len(parent.Content); i += 2 {
+				if parent.Content[i].Value == keys[len(keys)-1] {
+					parent.Content = append(parent.Content[:i], parent.Content[i+2:]...)
+					found = true
+					break
+				}
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("%w: key '%s' not found", ErrConfigInvalid, keyPath)
+		}
+
+		return docs, nil
+	})
+}
+
+func lastConfigDocument(docs []*yaml.Node, keys []string) *yaml.Node {
+	var doc *yaml.Node
+	for _, d := range docs {
+		if _, ok := findConfigNode(d, keys); ok {
+			doc = d
+		}
+	}
+
+	return doc
+}
+
+func readConfigDocuments(fs afero.Fs, name string) ([]byte, []*yaml.Node, error) {
+	// Read the file.
+	b, err := afero.ReadFile(fs, name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Parse the documents.
+	var docs []*yaml.Node
+	decoder := yaml.NewDecoder(bytes.NewReader(b))
+	for {
+		var doc yaml.Node
+		err := decoder.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", name, err)
+		}
+		docs = append(docs, &doc)
+	}
+
+	// Check that the documents are maps.
+	for _, doc := range docs {
+		if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+			return nil, nil, fmt.Errorf("%w: %s: expected a mapping", ErrConfigInvalid, name)
+		}
+	}
+
+	return b, docs, nil
+}
+
+func spliceConfigValue(fs afero.Fs, name string, keys []string, value *yaml.Node) (bool, error) {
+	b, docs, err := readConfigDocuments(fs, name)
+	if err != nil {
+		return false, err
+	}
+
+	// Find the value without going through aliases, which would change the
+	// anchored value.
+	doc := lastConfigDocument(docs, keys)
+	if doc == nil {
+		return false, nil
+	}
+	old := doc.Content[0]
+	for _, key := range keys {
+		if old.Kind == yaml.AliasNode {
+			return false, nil
+		}
+		if old, _ = childConfigNode(old, key); old == nil {
+			return false, nil
+		}
+	}
+
+	// Only replace single line scalars that are written as they are parsed.
+	start, end, ok := configScalarSpan(b, old)
+	if !ok || value.Kind != yaml.ScalarNode {
+		return false, nil
+	}
+
+	// Encode the new value on one line without the comments of the old value.
+	node := replacedConfigNode(old, value)
+	node.HeadComment, node.LineComment, node.FootComment = "", "", ""
+	out, err := yaml.Marshal(node)
+	if err != nil {
+		return false, err
+	}
+	text := strings.TrimSuffix(string(out), "\n")
+	if strings.Contains(text, "\n") || (node.Style == 0 && strings.ContainsAny(text, ",[]{}")) {
+		// Plain values with flow indicators could end a flow collection.
+		return false, nil
+	}
+
+	// Write the file.
+	info, err := fs.Stat(name)
+	if err != nil {
+		return false, err
+	}
+	spliced := append(append(slices.Clip(b[:start]), text...), b[end:]...)
+	return true, afero.WriteFile(fs, name, spliced, info.Mode())
+}
+
+func configScalarSpan(b []byte, node *yaml.Node) (int, int, bool) {
+	// Skip anchors, tags and block scalars, which are not only the value.
+	if node.Kind != yaml.ScalarNode || node.Anchor != "" || node.Style&^(yaml.SingleQuotedStyle|yaml.DoubleQuotedStyle) != 0 {
+		return 0, 0, false
+	}
+
+	// Find the line of the node.
+	offset := 0
+	for range node.Line - 1 {
+		i := bytes.IndexByte(b[offset:], '\n')
+		if i == -1 {
+			return 0, 0, false
+		}
+		offset += i + 1
+	}
+	line := b[offset:]
+	if i := bytes.IndexByte(line, '\n'); i != -1 {
+		line = line[:i]
+	}
+
+	// Convert the column, which counts characters, to a byte offset.
+	start := 0
+	for range node.Column - 1 {
+		if start >= len(line) {
+			return 0, 0, false
+		}
+		_, size := utf8.DecodeRune(line[start:])
+		start += size
+	}
+
+	// Find the end of the value on the line.
+	end := len(line)
+	switch node.Style {
+	case yaml.SingleQuotedStyle, yaml.DoubleQuotedStyle:
+		end = -1
+		quote := line[start]
+		for i := start + 1; i < len(line); i++ {
+			if quote == '"' && line[i] == '\\' {
+				i++
+			} else if quote == '\'' && line[i] == '\'' && i+1 < len(line) && line[i+1] == '\'' {
+				i++
+			} else if line[i] == quote {
+				end = i + 1
+				break
+			}
+		}
+		if end == -1 {
+			return 0, 0, false
+		}
+
+		// Check that the quoted text is the whole value.
+		var value string
+		if err := yaml.Unmarshal(line[start:end], &value); err != nil || value != node.Value {
+			return 0, 0, false
+		}
+	default:
+		// Plain values on one line are written as they are parsed.
+		if node.Value == "" || !bytes.HasPrefix(line[start:], []byte(node.Value)) {
+			return 0, 0, false
+		}
+		end = start + len(node.Value)
+	}
+
+	return offset + start, offset + end, true
+}
+
+func editConfigFile(fs afero.Fs, name string, edit func([]*yaml.Node) ([]*yaml.Node, error)) error {
+	b, docs, err := readConfigDocuments(fs, name)
+	if err != nil {
+		return err
+	}
+	info, err := fs.Stat(name)
+	if err != nil {
+		return err
+	}
+
+	// Edit the documents.
+	docs, err = edit(docs)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	// Encode the documents with the indentation of the original file.
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(detectIndent(b))
+	for _, doc := range docs {
+		if err := encoder.Encode(doc); err != nil {
+			return err
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		return err
+	}
+
+	// Write the file.
+	return afero.WriteFile(fs, name, buf.Bytes(), info.Mode())
+}
+
+func findConfigNode(node *yaml.Node, keys []string) (*yaml.Node, bool) {
+	if node.Kind == yaml.DocumentNode {
+		if len(node.Content) == 0 {
+			return nil, false
+		}
+		node = node.Content[0]
+	}
+
+	for _, key := range keys {
+		if node.Kind == yaml.AliasNode {
+			node = node.Alias
+		}
+
+		child, _ := childConfigNode(node, key)
+		if child == nil {
+			return nil, false
+		}
+		node = child
+	}
+
+	return node, true
+}
+
+func childConfigNode(node *yaml.Node, key string) (*yaml.Node, int) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				return node.Content[i+1], i + 1
+			}
+		}
+	case yaml.SequenceNode:
+		i, err := strconv.Atoi(key)
+		if err == nil && i >= 0 && i < len(node.Content) {
+			return node.Content[i], i
+		}
+	}
+
+	return nil, -1
+}
+
+func setConfigNode(node *yaml.Node, keys []string, keyPath string, value *yaml.Node) error {
+	for i, key := range keys {
+		// Changing a value through an alias would change the anchored value.
+		if node.Kind == yaml.AliasNode {
+			return fmt.Errorf("%w: key '%s' is an alias", ErrConfigInvalid, strings.Join(keys[:i], "."))
+		}
+
+		child, index := childConfigNode(node, key)
+
+		// Replace the last value, keeping its anchor, comments and quotes.
+		if i == len(keys)-1 {
+			if child != nil {
+				replaceConfigNode(node, index, child, value)
+				return nil
+			}
+
+			if node.Kind != yaml.MappingNode {
+				return fmt.Errorf("%w: key '%s' not found", ErrConfigInvalid, keyPath)
+			}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+			return nil
+		}
+
+		// Add missing maps along the path.
+		if child == nil {
+			if node.Kind != yaml.MappingNode {
+				return fmt.Errorf("%w: key '%s' not found", ErrConfigInvalid, keyPath)
+			}
+			child = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, child)
+		}
+		node = child
+	}
+
+	return nil
+}
+
+func replaceConfigNode(parent *yaml.Node, index int, old *yaml.Node, value *yaml.Node) {
+	parent.Content[index] = replacedConfigNode(old, value)
+}
+
+func replacedConfigNode(old *yaml.Node, value *yaml.Node) *yaml.Node {
+	node := *value
+	node.Anchor = old.Anchor
+	node.HeadComment = old.HeadComment
+	node.LineComment = old.LineComment
+	node.FootComment = old.FootComment
+
+	// Keep strings as strings with the same quotes.
+	if old.Kind == yaml.ScalarNode && node.Kind == yaml.ScalarNode && old.ShortTag() == "!!str" {
+		node.Tag = old.Tag
+		if node.Style == 0 {
+			node.Style = old.Style
+		}
+	}
+
+	return &node
+}
+
+func isChangedNumber(node *yaml.Node) bool {
+	if node.Kind != yaml.ScalarNode || node.Style != 0 {
+		return false
+	}
+
+	switch node.ShortTag() {
+	case "!!float":
+		// Decimal numbers are usually versions.
+		return true
+	case "!!int":
+		// Check for leading zeros, signs and other bases.
+		i, err := strconv.ParseInt(node.Value, 10, 64)
+		return err != nil || strconv.FormatInt(i, 10) != node.Value
+	}
+
+	return false
+}
+
+func detectIndent(b []byte) int {
+	// Use the smallest indentation of a line in the file.
+	indent := 0
+	for _, line := range strings.Split(string(b), "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		n := len(line) - len(trimmed)
+		if n > 0 && trimmed != "" && !strings.HasPrefix(trimmed, "#") && !strings.HasPrefix(trimmed, "- ") && (indent == 0 || n < indent) {
+			indent = n
+		}
+	}
+
+	if indent < 2 {
+		return 2
+	}
+
+	return indent
+}
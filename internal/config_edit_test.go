@@ -0,0 +1,149 @@
+package internal
+
+import (
+	"path"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetConfigValue(t *testing.T) {
+	t.Parallel()
+
+	th := NewTestHarness(t, afero.NewMemMapFs())
+	config := path.Join(th.TempDir(), "config.yml")
+	th.WriteFileString(config, `# The product config.
+Config:
+  # The version to release.
+  Version: "1.2.2" # bumped by CI
+  Base: &base
+    Image: ubuntu
+  Other: *base
+  Packages:
+    - git
+    - curl
+`)
+
+	require.NoError(t, SetConfigValue(th.fs, config, "Config.Version", "1.2.3"))
+	require.NoError(t, SetConfigValue(th.fs, config, "Config.Packages.1", "wget"))
+	require.NoError(t, SetConfigValue(th.fs, config, "Config.Go.Version", "1.22"))
+	require.NoError(t, SetConfigValue(th.fs, config, "Config.Base.Image", "debian"))
+	assert.Equal(t, `# The product config.
+Config:
+  # The version to release.
+  Version: "1.2.3" # bumped by CI
+  Base: &base
+    Image: debian
+  Other: *base
+  Packages:
+    - git
+    - wget
+  Go:
+    Version: "1.22"
+`, th.ReadFileString(config))
+
+	// Check that the file is still valid config.
+	spec := th.NewConfigSpec(config)
+	assert.Equal(t, map[string]any{"Image": "debian"}, spec.config["Other"])
+}
+
+func TestSetConfigValueKeepsStrings(t *testing.T) {
+	t.Parallel()
+
+	th := NewTestHarness(t, afero.NewMemMapFs())
+	config := path.Join(th.TempDir(), "config.yml")
+	th.WriteFileString(config, "Config:\n  Go: go1\n  Node: '18'\n  Port: 80\n")
+
+	require.NoError(t, SetConfigValue(th.fs, config, "Config.Go", "1.20"))
+	require.NoError(t, SetConfigValue(th.fs, config, "Config.Node", "20"))
+	require.NoError(t, SetConfigValue(th.fs, config, "Config.Port", "8080"))
+	require.NoError(t, SetConfigValue(th.fs, config, "Config.Mode", "0755"))
+	require.NoError(t, SetConfigValue(th.fs, config, "Config.Debug", "true"))
+	assert.Equal(t, "Config:\n  Go: \"1.20\"\n  Node: '20'\n  Port: 8080\n  Mode: \"0755\"\n  Debug: true\n", th.ReadFileString(config))
+
+	spec := th.NewConfigSpec(config)
+	assert.Equal(t, map[string]any{"Go": "1.20", "Node": "20", "Port": 8080, "Mode": "0755", "Debug": true}, spec.config)
+}
+
+func TestSetConfigValueKeepsFormatting(t *testing.T) {
+	t.Parallel()
+
+	th := NewTestHarness(t, afero.NewMemMapFs())
+	config := path.Join(th.TempDir(), "config.yml")
+	content := `Config:
+  Version:   1.2.2    # bumped by CI
+  Name: 'app''s'
+  Empty:
+  Ports: [80, 443]
+
+  # Images
+  Image:    "ubuntu:22.04"
+  Tag: ~
+`
+	th.WriteFileString(config, content)
+
+	// Check that existing values are replaced without changing other lines.
+	require.NoError(t, SetConfigValue(th.fs, config, "Config.Version", "1.2.3"))
+	require.NoError(t, SetConfigValue(th.fs, config, "Config.Name", "app"))
+	require.NoError(t, SetConfigValue(th.fs, config, "Config.Image", "debian:12"))
+	require.NoError(t, SetConfigValue(th.fs, config, "Config.Tag", "1.20"))
+	require.NoError(t, SetConfigValue(th.fs, config, "Config.Ports.1", "8443"))
+	assert.Equal(t, `Config:
+  Version:   1.2.3    # bumped by CI
+  Name: 'app'
+  Empty:
+  Ports: [80, 8443]
+
+  # Images
+  Image:    "debian:12"
+  Tag: "1.20"
+`, th.ReadFileString(config))
+
+	// Check that values that cannot be replaced in place are still set.
+	require.NoError(t, SetConfigValue(th.fs, config, "Config.Empty", "set"))
+	require.NoError(t, SetConfigValue(th.fs, config, "Config.Ports.0", "a, b"))
+	spec := th.NewConfigSpec(config)
+	assert.Equal(t, "set", spec.config["Empty"])
+	assert.Equal(t, "1.20", spec.config["Tag"])
+	assert.Equal(t, []any{"a, b", 8443}, spec.config["Ports"])
+}
+
+func TestSetConfigValueInLastDocument(t *testing.T) {
+	t.Parallel()
+
+	th := NewTestHarness(t, afero.NewMemMapFs())
+	config := path.Join(th.TempDir(), "config.yml")
+	th.WriteFileString(config, "Config:\n    Version: 1\n---\nConfig:\n    Version: 2\n")
+
+	require.NoError(t, SetConfigValue(th.fs, config, "Config.Version", "3"))
+	assert.Equal(t, "Config:\n    Version: 1\n---\nConfig:\n    Version: 3\n", th.ReadFileString(config))
+}
+
+func TestSetConfigValueWhenInvalid(t *testing.T) {
+	t.Parallel()
+
+	th := NewTestHarness(t, afero.NewMemMapFs())
+	config := path.Join(th.TempDir(), "config.yml")
+	th.WriteFileString(config, "Config:\n  Base: &base\n    Image: ubuntu\n  Other: *base\n  Packages: [git]\n")
+
+	for _, keyPath := range []string{"Config.Other.Image", "Config.Packages.1", "Config.Packages.x"} {
+		err := SetConfigValue(th.fs, config, keyPath, "x")
+		require.ErrorIs(t, err, ErrConfigInvalid, keyPath)
+	}
+}
+
+func TestUnsetConfigValue(t *testing.T) {
+	t.Parallel()
+
+	th := NewTestHarness(t, afero.NewMemMapFs())
+	config := path.Join(th.TempDir(), "config.yml")
+	th.WriteFileString(config, "Config:\n  # Keep me.\n  Keep: true\n  Remove: true\n---\nConfig:\n  Remove: false\n")
+
+	require.NoError(t, UnsetConfigValue(th.fs, config, "Config.Remove"))
+	assert.Equal(t, "Config:\n  # Keep me.\n  Keep: true\n---\nConfig: {}\n", th.ReadFileString(config))
+
+	err := UnsetConfigValue(th.fs, config, "Config.Remove")
+	require.ErrorIs(t, err, ErrConfigInvalid)
+}
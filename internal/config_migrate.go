@@ -0,0 +1,315 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v3"
+)
+
+const configMigrationsName = "_migrations.yml"
+
+type ConfigMigrations struct {
+	Migrations []ConfigMigration `yaml:"Migrations"`
+}
+
+type ConfigMigration struct {
+	Version int               `yaml:"Version"`
+	Rename  []ConfigKeyRename `yaml:"Rename"`
+	Remove  []string          `yaml:"Remove"`
+}
+
+type ConfigKeyRename struct {
+	From string `yaml:"From"`
+	To   string `yaml:"To"`
+}
+
+func LoadConfigMigrations(fs afero.Fs, name string) (*ConfigMigrations, error) {
+	// Read the file at the given path.
+	b, err := afero.ReadFile(fs, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseConfigMigrations(name, b)
+}
+
+func LoadMountedConfigMigrations(fs afero.Fs, mounts Mounts, name string, lock *Lock) (*ConfigMigrations, error) {
+	// Read a named file through the mounts, or from the host when it is not
+	// mounted.
+	if name != "" {
+		b, err := readMountedConfigMigrations(mounts, name, lock)
+		if errors.Is(err, os.ErrNotExist) {
+			return LoadConfigMigrations(fs, name)
+		} else if err != nil {
+			return nil, err
+		}
+
+		return parseConfigMigrations(name, b)
+	}
+
+	// Otherwise, use the migrations shipped at the root of a mounted
+	// directory, if any.
+	var names []string
+	for _, mount := range mounts {
+		name := path.Join(mount.targetPath, configMigrationsName)
+		if !mount.directory || slices.Contains(names, name) {
+			continue
+		}
+
+		if _, err := mounts.Stat(name); err == nil {
+			names = append(names, name)
+		}
+	}
+
+	switch len(names) {
+	case 0:
+		return nil, nil
+	case 1:
+		b, err := readMountedConfigMigrations(mounts, names[0], lock)
+		if err != nil {
+			return nil, err
+		}
+
+		return parseConfigMigrations(names[0], b)
+	default:
+		return nil, fmt.Errorf("%w: several migrations files are mounted, choose one: %s", ErrConfigMigration, strings.Join(names, ", "))
+	}
+}
+
+func readMountedConfigMigrations(mounts Mounts, name string, lock *Lock) ([]byte, error) {
+	// Only absolute paths can be mounted.
+	if !path.IsAbs(name) {
+		return nil, os.ErrNotExist
+	}
+
+	b, err := mounts.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check the file against the lockfile.
+	if err := lock.verify(name, b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func parseConfigMigrations(name string, b []byte) (*ConfigMigrations, error) {
+	// Unmarshal the migrations.
+	var migrations ConfigMigrations
+	if err := yaml.Unmarshal(b, &migrations); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	// Check that the versions increase and that the keys are given.
+	version := 0
+	for _, migration := range migrations.Migrations {
+		if migration.Version <= version {
+			return nil, fmt.Errorf("%w: %s: versions must be positive and increasing", ErrConfigMigration, name)
+		}
+		version = migration.Version
+
+		for _, rename := range migration.Rename {
+			if rename.From == "" || rename.To == "" {
+				return nil, fmt.Errorf("%w: %s: version %d: rename requires 'From' and 'To'", ErrConfigMigration, name, version)
+			}
+		}
+		for _, key := range migration.Remove {
+			if key == "" {
+				return nil, fmt.Errorf("%w: %s: version %d: remove requires a key", ErrConfigMigration, name, version)
+			}
+		}
+	}
+
+	return &migrations, nil
+}
+
+func (m *ConfigMigrations) Version() int {
+	if len(m.Migrations) == 0 {
+		return 0
+	}
+
+	return m.Migrations[len(m.Migrations)-1].Version
+}
+
+func (m *ConfigMigrations) Apply(doc *yaml.Node, warn func(line int, format string, args ...any) error) (bool, error) {
+	root := doc
+	if root.Kind == yaml.DocumentNode {
+		root = root.Content[0]
+	}
+
+	// Get the schema version of the document.
+	version := 0
+	if node, ok := findConfigNode(root, []string{"SchemaVersion"}); ok {
+		v, err := strconv.Atoi(node.Value)
+		if err != nil {
+			return false, fmt.Errorf("%w: line %d: SchemaVersion must be an integer", ErrConfigMigration, node.Line)
+		}
+		version = v
+	}
+
+	// Warn about files written for a newer template library.
+	if version > m.Version() {
+		if err := warn(0, "SchemaVersion %d is newer than the latest migration %d", version, m.Version()); err != nil {
+			return false, err
+		}
+	}
+
+	// Collect the config and the profiles, which use the same keys.
+	targets := map[string]*yaml.Node{}
+	if node, ok := findConfigNode(root, []string{"Config"}); ok && node.Kind == yaml.MappingNode {
+		targets["Config"] = node
+	}
+	if profiles, ok := findConfigNode(root, []string{"Profiles"}); ok && profiles.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(profiles.Content); i += 2 {
+			if profiles.Content[i+1].Kind == yaml.MappingNode {
+				targets[joinKeyPath("Profiles", profiles.Content[i].Value)] = profiles.Content[i+1]
+			}
+		}
+	}
+	prefixes := sortedKeys(targets)
+
+	// Apply the newer migrations in order.
+	changed := false
+	for _, migration := range m.Migrations {
+		if migration.Version <= version {
+			continue
+		}
+
+		for _, prefix := range prefixes {
+			target := targets[prefix]
+
+			// Rename keys.
+			for _, rename := range migration.Rename {
+				keyNode, valueNode := cutConfigNode(target, splitKeyPath(rename.From))
+				if keyNode == nil {
+					continue
+				}
+				changed = true
+
+				from, to := joinKeyPath(prefix, rename.From), joinKeyPath(prefix, rename.To)
+				if _, ok := findConfigNode(target, splitKeyPath(rename.To)); ok {
+					if err := warn(keyNode.Line, "%s: deprecated in schema version %d and ignored since %s is set", from, migration.Version, to); err != nil {
+						return false, err
+					}
+					continue
+				}
+
+				if err := warn(keyNode.Line, "%s: deprecated in schema version %d; renamed to %s", from, migration.Version, to); err != nil {
+					return false, err
+				}
+				if err := setConfigNode(target, splitKeyPath(rename.To), to, valueNode); err != nil {
+					return false, err
+				}
+				moveConfigKey(target, splitKeyPath(rename.To), keyNode)
+			}
+
+			// Remove keys.
+			for _, key := range migration.Remove {
+				keyNode, _ := cutConfigNode(target, splitKeyPath(key))
+				if keyNode == nil {
+					continue
+				}
+				changed = true
+
+				if err := warn(keyNode.Line, "%s: removed in schema version %d", joinKeyPath(prefix, key), migration.Version); err != nil {
+					return false, err
+				}
+			}
+		}
+	}
+
+	return changed, nil
+}
+
+func cutConfigNode(node *yaml.Node, keys []string) (*yaml.Node, *yaml.Node) {
+	parent, ok := findConfigNode(node, keys[:len(keys)-1])
+	if !ok || parent.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+
+	// Remove the key and value from the parent.
+	for i := 0; i+1 < len(parent.Content); i += 2 {
+		if parent.Content[i].Value == keys[len(keys)-1] {
+			keyNode, valueNode := parent.Content[i], parent.Content[i+1]
+			parent.Content = append(parent.Content[:i], parent.Content[i+2:]...)
+			return keyNode, valueNode
+		}
+	}
+
+	return nil, nil
+}
+
+func moveConfigKey(node *yaml.Node, keys []string, from *yaml.Node) {
+	parent, ok := findConfigNode(node, keys[:len(keys)-1])
+	if !ok || parent.Kind != yaml.MappingNode {
+		return
+	}
+
+	// Keep the comments and line of the old key on the new key.
+	for i := 0; i+1 < len(parent.Content); i += 2 {
+		if parent.Content[i].Value == keys[len(keys)-1] {
+			parent.Content[i].HeadComment = from.HeadComment
+			parent.Content[i].LineComment = from.LineComment
+			parent.Content[i].FootComment = from.FootComment
+			parent.Content[i].Line = from.Line
+			return
+		}
+	}
+}
+
+func MigrateConfigFile(fs afero.Fs, name string, migrations *ConfigMigrations) ([]ConfigWarning, error) {
+	var warnings []ConfigWarning
+	err := editConfigFile(fs, name, func(docs []*yaml.Node) ([]*yaml.Node, error) {
+		for _, doc := range docs {
+			// Apply the migrations and collect the changes.
+			_, err := migrations.Apply(doc, func(line int, format string, args ...any) error {
+				warnings = append(warnings, ConfigWarning{name, line, fmt.Sprintf(format, args...)})
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			// Record the latest schema version at the top of the document.
+			root := doc.Content[0]
+			version := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(migrations.Version())}
+			if node, ok := findConfigNode(root, []string{"SchemaVersion"}); ok {
+				node.Value = version.Value
+			} else if root.Kind == yaml.MappingNode {
+				key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "SchemaVersion"}
+				if len(root.Content) > 0 {
+					key.HeadComment, root.Content[0].HeadComment = root.Content[0].HeadComment, ""
+				}
+				root.Content = append([]*yaml.Node{key, version}, root.Content...)
+			}
+		}
+
+		return docs, nil
+	})
+
+	return warnings, err
+}
+
+func (c *ConfigSpec) migrate(name string, doc *configDocument) error {
+	if c.migrations == nil {
+		return nil
+	}
+
+	_, err := c.migrations.Apply(doc.node, func(line int, format string, args ...any) error {
+		return c.warn(name, line, format, args...)
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	return nil
+}
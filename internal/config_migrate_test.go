@@ -0,0 +1,186 @@
+package internal
+
+import (
+	"path"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testConfigMigrations = `Migrations:
+  - Version: 2
+    Rename:
+      - From: Registry
+        To: Image.Registry
+    Remove:
+      - Legacy
+  - Version: 3
+    Rename:
+      - From: Image.Registry
+        To: Image.Host
+`
+
+func TestNewConfigSpecWithMigrations(t *testing.T) {
+	t.Parallel()
+
+	th := NewTestHarness(t, afero.NewMemMapFs())
+	migrations := path.Join(th.TempDir(), "migrations.yml")
+	th.WriteFileString(migrations, testConfigMigrations)
+	config := path.Join(th.TempDir(), "config.yml")
+	th.WriteFileString(config, `Config:
+  Registry: example.com
+  Legacy: true
+Profiles:
+  prod:
+    Registry: prod.example.com
+`)
+
+	opts := DefaultOptions()
+	opts.ConfigMigrations = migrations
+	opts.Profiles = []string{"prod"}
+	spec := th.NewConfigSpecWithOptions(opts, config)
+	assert.Equal(t, map[string]any{"Image": map[string]any{"Host": "prod.example.com"}}, spec.config)
+	assert.Equal(t, []ConfigWarning{
+		{config, 2, "Config.Registry: deprecated in schema version 2; renamed to Config.Image.Registry"},
+		{config, 3, "Config.Legacy: removed in schema version 2"},
+		{config, 6, "Profiles.prod.Registry: deprecated in schema version 2; renamed to Profiles.prod.Image.Registry"},
+		{config, 2, "Config.Image.Registry: deprecated in schema version 3; renamed to Config.Image.Host"},
+		{config, 6, "Profiles.prod.Image.Registry: deprecated in schema version 3; renamed to Profiles.prod.Image.Host"},
+	}, spec.Warnings())
+}
+
+func TestNewConfigSpecWithMigrationsAndSchemaVersion(t *testing.T) {
+	t.Parallel()
+
+	th := NewTestHarness(t, afero.NewMemMapFs())
+	migrations := path.Join(th.TempDir(), "migrations.yml")
+	th.WriteFileString(migrations, testConfigMigrations)
+	config := path.Join(th.TempDir(), "config.yml")
+	th.WriteFileString(config, `SchemaVersion: 2
+Config:
+  Image:
+    Registry: example.com
+    Host: other.example.com
+`)
+
+	opts := DefaultOptions()
+	opts.ConfigMigrations = migrations
+	spec := th.NewConfigSpecWithOptions(opts, config)
+	assert.Equal(t, map[string]any{"Image": map[string]any{"Host": "other.example.com"}}, spec.config)
+	assert.Equal(t, []ConfigWarning{
+		{config, 4, "Config.Image.Registry: deprecated in schema version 3 and ignored since Config.Image.Host is set"},
+	}, spec.Warnings())
+}
+
+func TestNewConfigSpecWithMigrationsAndStrictConfig(t *testing.T) {
+	t.Parallel()
+
+	th := NewTestHarness(t, afero.NewMemMapFs())
+	migrations := path.Join(th.TempDir(), "migrations.yml")
+	th.WriteFileString(migrations, testConfigMigrations)
+	config := path.Join(th.TempDir(), "config.yml")
+	th.WriteFileString(config, "Config:\n  Legacy: true\n")
+
+	opts := DefaultOptions()
+	opts.ConfigMigrations = migrations
+	opts.StrictConfig = true
+	_, err := NewConfigSpec(th.fs, nil, []string{config}, opts)
+	assert.ErrorIs(t, err, ErrConfigStrict)
+	assert.ErrorContains(t, err, config+":2: Config.Legacy: removed in schema version 2")
+}
+
+func TestNewConfigSpecWithMountedMigrations(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+	th := NewTestHarness(t, fs)
+	lib := th.TempDir()
+	th.WriteFileString(path.Join(lib, configMigrationsName), testConfigMigrations)
+	th.WriteFileString(path.Join(lib, "migrations", "v3.yml"), testConfigMigrations)
+	config := path.Join(th.TempDir(), "config.yml")
+	th.WriteFileString(config, "Config:\n  Registry: example.com\n")
+
+	// Check that the migrations at the root of a mounted library are applied.
+	mounts := th.NewMounts(lib + ":/lib")
+	spec, err := NewConfigSpec(fs, mounts, []string{config}, DefaultOptions())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"Image": map[string]any{"Host": "example.com"}}, spec.config)
+
+	// Check that a mounted path can be given.
+	opts := DefaultOptions()
+	opts.ConfigMigrations = "/lib/migrations/v3.yml"
+	spec, err = NewConfigSpec(fs, th.NewMounts(lib+"/migrations:/lib/migrations"), []string{config}, opts)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"Image": map[string]any{"Host": "example.com"}}, spec.config)
+
+	// Check that several mounted migrations files must be chosen between.
+	mounts = th.NewMounts(lib+":/lib", lib+":/other")
+	_, err = NewConfigSpec(fs, mounts, []string{config}, DefaultOptions())
+	assert.ErrorIs(t, err, ErrConfigMigration)
+	assert.ErrorContains(t, err, "/other/_migrations.yml, /lib/_migrations.yml")
+
+	opts.ConfigMigrations = "/lib/_migrations.yml"
+	_, err = NewConfigSpec(fs, mounts, []string{config}, opts)
+	require.NoError(t, err)
+}
+
+func TestLoadConfigMigrationsInvalid(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"versions must be positive and increasing": "Migrations:\n  - Version: 2\n  - Version: 1\n",
+		"rename requires 'From' and 'To'":          "Migrations:\n  - Version: 1\n    Rename:\n      - From: A\n",
+		"remove requires a key":                    "Migrations:\n  - Version: 1\n    Remove: ['']\n",
+	}
+
+	for message, content := range tests {
+		t.Run(message, func(t *testing.T) {
+			t.Parallel()
+
+			th := NewTestHarness(t, afero.NewMemMapFs())
+			migrations := path.Join(th.TempDir(), "migrations.yml")
+			th.WriteFileString(migrations, content)
+
+			_, err := LoadConfigMigrations(th.fs, migrations)
+			assert.ErrorIs(t, err, ErrConfigMigration)
+			assert.ErrorContains(t, err, message)
+		})
+	}
+}
+
+func TestMigrateConfigFile(t *testing.T) {
+	t.Parallel()
+
+	th := NewTestHarness(t, afero.NewMemMapFs())
+	migrations := path.Join(th.TempDir(), "migrations.yml")
+	th.WriteFileString(migrations, testConfigMigrations)
+	config := path.Join(th.TempDir(), "config.yml")
+	th.WriteFileString(config, `# The product config.
+Config:
+  # The registry to push to.
+  Registry: example.com # internal
+  Legacy: true
+  Version: "1.2.3"
+`)
+
+	m, err := LoadConfigMigrations(th.fs, migrations)
+	require.NoError(t, err)
+	warnings, err := MigrateConfigFile(th.fs, config, m)
+	require.NoError(t, err)
+	assert.Len(t, warnings, 3)
+	assert.Equal(t, `# The product config.
+SchemaVersion: 3
+Config:
+  Version: "1.2.3"
+  Image:
+    # The registry to push to.
+    Host: example.com # internal
+`, th.ReadFileString(config))
+
+	// Check that migrating again changes nothing.
+	warnings, err = MigrateConfigFile(th.fs, config, m)
+	require.NoError(t, err)
+	assert.Empty(t, warnings)
+}
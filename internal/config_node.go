@@ -0,0 +1,228 @@
+package internal
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Plain scalars that YAML 1.1 decodes as booleans but YAML 1.2 decodes as
+// strings.
+var ambiguousBooleans = map[string]bool{
+	"y": true, "Y": true, "yes": true, "Yes": true, "YES": true,
+	"n": true, "N": true, "no": true, "No": true, "NO": true,
+	"on": true, "On": true, "ON": true,
+	"off": true, "Off": true, "OFF": true,
+}
+
+var integerRegexp = regexp.MustCompile(`^[-+]?[0-9]+$`)
+
+type configDocument struct {
+	node  *yaml.Node
+	lines map[string]int
+}
+
+func (d *configDocument) line(keyPath string) int {
+	return d.lines[keyPath]
+}
+
+type ConfigMap map[string]any
+
+func (m *ConfigMap) UnmarshalYAML(node *yaml.Node) error {
+	v, err := decodeConfigNode(node)
+	if err != nil {
+		return err
+	}
+
+	// Check that the value is a map.
+	switch t := v.(type) {
+	case nil:
+		*m = nil
+	case map[string]any:
+		*m = t
+	default:
+		return fmt.Errorf("%w: line %d: expected a mapping", ErrConfigInvalid, node.Line)
+	}
+
+	return nil
+}
+
+func decodeConfigNode(node *yaml.Node) (any, error) {
+	switch node.Kind {
+	case 0:
+		return nil, nil
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return nil, nil
+		}
+		return decodeConfigNode(node.Content[0])
+	case yaml.AliasNode:
+		return decodeConfigNode(node.Alias)
+	case yaml.SequenceNode:
+		out := make([]any, 0, len(node.Content))
+		for _, child := range node.Content {
+			v, err := decodeConfigNode(child)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+		}
+		return out, nil
+	case yaml.MappingNode:
+		return decodeConfigMapping(node)
+	default:
+		return decodeConfigScalar(node)
+	}
+}
+
+func decodeConfigMapping(node *yaml.Node) (map[string]any, error) {
+	out := make(map[string]any, len(node.Content)/2)
+	lines := make(map[string]int, len(node.Content)/2)
+	var merged []map[string]any
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keyNode, valueNode := node.Content[i], node.Content[i+1]
+
+		// Collect merge keys to apply after the explicit keys.
+		if keyNode.ShortTag() == "!!merge" {
+			sources := []*yaml.Node{valueNode}
+			if valueNode.Kind == yaml.SequenceNode {
+				sources = valueNode.Content
+			}
+			for _, source := range sources {
+				v, err := decodeConfigNode(source)
+				if err != nil {
+					return nil, err
+				}
+				m, ok := v.(map[string]any)
+				if !ok {
+					return nil, fmt.Errorf("%w: line %d: merge key requires a mapping", ErrConfigInvalid, source.Line)
+				}
+				merged = append(merged, m)
+			}
+			continue
+		}
+
+		// Check for duplicate keys.
+		key := keyNode.Value
+		if line, ok := lines[key]; ok {
+			return nil, fmt.Errorf("%w: line %d: duplicate key '%s' (first defined at line %d)", ErrConfigInvalid, keyNode.Line, key, line)
+		}
+		lines[key] = keyNode.Line
+
+		// Decode the value.
+		v, err := decodeConfigNode(valueNode)
+		if err != nil {
+			return nil, err
+		}
+		out[key] = v
+	}
+
+	// Explicit keys take precedence over merged keys, and earlier merged maps
+	// take precedence over later ones.
+	for _, m := range merged {
+		for k, v := range m {
+			if _, ok := out[k]; !ok {
+				out[k] = v
+			}
+		}
+	}
+
+	return out, nil
+}
+
+func decodeConfigScalar(node *yaml.Node) (any, error) {
+	switch node.ShortTag() {
+	case "!!null":
+		return nil, nil
+	case "!!str":
+		return node.Value, nil
+	case "!!binary":
+		b, err := base64.StdEncoding.DecodeString(node.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: invalid base64 data", ErrConfigInvalid, node.Line)
+		}
+		return b, nil
+	case "!!int":
+		var v any
+		if err := node.Decode(&v); err != nil {
+			return nil, err
+		}
+
+		// Keep integers as int whenever they fit.
+		switch t := v.(type) {
+		case int:
+			return t, nil
+		case int64:
+			return int(t), nil
+		case uint64:
+			if t <= math.MaxInt {
+				return int(t), nil
+			}
+			return t, nil
+		}
+		return v, nil
+	case "!!float":
+		var v float64
+		if err := node.Decode(&v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	case "!!timestamp":
+		var v time.Time
+		if err := node.Decode(&v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	case "!!bool":
+		var v bool
+		if err := node.Decode(&v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	default:
+		return node.Value, nil
+	}
+}
+
+func (c *ConfigSpec) inspect(name string, keyPath string, node *yaml.Node, lines map[string]int) error {
+	switch node.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for i, child := range node.Content {
+			childPath := keyPath
+			if node.Kind == yaml.SequenceNode {
+				childPath = joinKeyPath(keyPath, strconv.Itoa(i))
+			}
+			if err := c.inspect(name, childPath, child, lines); err != nil {
+				return err
+			}
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			keyNode, valueNode := node.Content[i], node.Content[i+1]
+			childPath := joinKeyPath(keyPath, keyNode.Value)
+			if _, ok := lines[childPath]; !ok {
+				lines[childPath] = keyNode.Line
+			}
+			if err := c.inspect(name, childPath, valueNode, lines); err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		// Warn about plain values that depend on the YAML version.
+		if node.Style == 0 && node.ShortTag() == "!!str" && ambiguousBooleans[node.Value] {
+			return c.warn(name, node.Line, "%s: '%s' is a string, but a boolean in YAML 1.1; quote it or use true or false", keyPath, node.Value)
+		}
+
+		// Warn about integers that are too large and lose precision.
+		if node.ShortTag() == "!!float" && integerRegexp.MatchString(node.Value) {
+			return c.warn(name, node.Line, "%s: integer '%s' is out of range and is decoded as a float; quote it to keep it as a string", keyPath, node.Value)
+		}
+	}
+
+	return nil
+}
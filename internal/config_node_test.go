@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"path"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestDecodeConfigNode(t *testing.T) {
+	t.Parallel()
+
+	var node yaml.Node
+	err := yaml.Unmarshal([]byte(`Int: 42
+Hex: 0x10
+Float: 1.0
+Bool: true
+Null: ~
+String: "42"
+Timestamp: 2024-01-02
+Binary: !!binary aGVsbG8=
+Base: &base
+  A: a
+  B: b
+Merged:
+  <<: *base
+  B: c
+List: [1, two]`), &node)
+	require.NoError(t, err)
+
+	v, err := decodeConfigNode(&node)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{
+		"Int":       42,
+		"Hex":       16,
+		"Float":     1.0,
+		"Bool":      true,
+		"Null":      nil,
+		"String":    "42",
+		"Timestamp": time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		"Binary":    []byte("hello"),
+		"Base":      map[string]any{"A": "a", "B": "b"},
+		"Merged":    map[string]any{"A": "a", "B": "c"},
+		"List":      []any{1, "two"},
+	}, v)
+}
+
+func TestDecodeConfigNodeWhenDuplicateKey(t *testing.T) {
+	t.Parallel()
+
+	var node yaml.Node
+	err := yaml.Unmarshal([]byte("A: 1\nB: 2\nA: 3"), &node)
+	require.NoError(t, err)
+
+	_, err = decodeConfigNode(&node)
+	require.ErrorIs(t, err, ErrConfigInvalid)
+	assert.Contains(t, err.Error(), "line 3: duplicate key 'A' (first defined at line 1)")
+}
+
+func TestNewConfigSpecWarnings(t *testing.T) {
+	t.Parallel()
+
+	// Prepare the test.
+	th := NewTestHarness(t, afero.NewMemMapFs())
+	dir := th.TempDir()
+
+	// Write the config files.
+	config1 := path.Join(dir, "config1.yml")
+	th.WriteFileString(config1, `Config:
+  Go:
+    Version: "1.22"
+  Country: "CA"`)
+
+	config2 := path.Join(dir, "config2.yml")
+	th.WriteFileString(config2, `Config:
+  Country: no
+  Go: "1.23"
+  Big: 99999999999999999999`)
+
+	spec := th.NewConfigSpec(config1, config2)
+	assert.Equal(t, []ConfigWarning{
+		{File: config2, Line: 2, Message: "Config.Country: 'no' is a string, but a boolean in YAML 1.1; quote it or use true or false"},
+		{File: config2, Line: 4, Message: "Config.Big: integer '99999999999999999999' is out of range and is decoded as a float; quote it to keep it as a string"},
+		{File: config2, Line: 3, Message: "Config.Go: type conflict: map replaced by string"},
+	}, spec.Warnings())
+	assert.Equal(t, config2+":3: Config.Go: type conflict: map replaced by string", spec.Warnings()[2].String())
+}
+
+func TestNewConfigSpecWhenStrict(t *testing.T) {
+	t.Parallel()
+
+	// Prepare the test.
+	th := NewTestHarness(t, afero.NewMemMapFs())
+	dir := th.TempDir()
+
+	// Write the config files.
+	config1 := path.Join(dir, "config1.yml")
+	th.WriteFileString(config1, "Config:\n  Port: 80")
+
+	config2 := path.Join(dir, "config2.yml")
+	th.WriteFileString(config2, "Config:\n  Port: [80, 443]")
+
+	opts := DefaultOptions()
+	opts.StrictConfig = true
+	_, err := NewConfigSpec(th.fs, nil, []string{config1, config2}, opts)
+	require.ErrorIs(t, err, ErrConfigStrict)
+	assert.Contains(t, err.Error(), config2+":2: Config.Port: type conflict: int replaced by list")
+}
+
+func TestNewConfigSpecWhenEmpty(t *testing.T) {
+	t.Parallel()
+
+	// Prepare the test.
+	th := NewTestHarness(t, afero.NewMemMapFs())
+	dir := th.TempDir()
+
+	for _, content := range []string{"", "Config:", "Config: []"} {
+		config := path.Join(dir, "config.yml")
+		th.WriteFileString(config, content)
+
+		_, err := NewConfigSpec(th.fs, nil, []string{config}, DefaultOptions())
+		require.ErrorIs(t, err, ErrConfigInvalid, content)
+	}
+}
@@ -0,0 +1,341 @@
+package internal
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+type patchOperation struct {
+	Op    string
+	Path  string
+	From  string
+	Value any
+}
+
+func (c *ConfigSpec) Patch(name string) error {
+	// Read the patch documents.
+	docs, err := c.readDocuments(name)
+	if err != nil {
+		return err
+	}
+
+	for _, doc := range docs {
+		v, err := decodeConfigNode(doc.node)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+
+		// A list is a JSON patch and a map is a merge patch.
+		switch t := v.(type) {
+		case []any:
+			err = c.jsonPatch(name, t)
+		case map[string]any:
+			c.config = c.mergePatch(name, "", c.config, t).(map[string]any)
+		default:
+			err = fmt.Errorf("%w: %s: expected a list of operations or a map", ErrConfigPatch, name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// Success.
+	return nil
+}
+
+func (c *ConfigSpec) mergePatch(name string, keyPath string, target any, patch any) any {
+	// Values other than maps replace the target.
+	patchMap, ok := patch.(map[string]any)
+	if !ok {
+		c.forget(keyPath)
+		c.provenance[keyPath] = []string{name}
+		return patch
+	}
+
+	// Maps are merged into the target, replacing other values.
+	targetMap, ok := target.(map[string]any)
+	if !ok {
+		c.forget(keyPath)
+		targetMap = map[string]any{}
+	}
+	out := make(map[string]any, len(targetMap))
+	for k, v := range targetMap {
+		out[k] = v
+	}
+
+	// Null values remove keys.
+	for k, v := range patchMap {
+		childPath := joinKeyPath(keyPath, k)
+		if v == nil {
+			delete(out, k)
+			c.forget(childPath)
+			continue
+		}
+		out[k] = c.mergePatch(name, childPath, out[k], v)
+	}
+
+	return out
+}
+
+func (c *ConfigSpec) jsonPatch(name string, operations []any) error {
+	var config any = c.config
+	for i, operation := range operations {
+		// Decode the operation.
+		op, err := decodePatchOperation(operation)
+		if err == nil {
+			config, err = c.applyPatchOperation(name, config, op)
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %s: operation %d (%s %s): %w", ErrConfigPatch, name, i+1, op.Op, op.Path, err)
+		}
+	}
+
+	// The root of the config must remain a map.
+	m, ok := config.(map[string]any)
+	if !ok {
+		return fmt.Errorf("%w: %s: config must be a map", ErrConfigPatch, name)
+	}
+
+	c.config = m
+	return nil
+}
+
+func decodePatchOperation(v any) (patchOperation, error) {
+	m, ok := v.(map[string]any)
+	if !ok {
+		return patchOperation{}, fmt.Errorf("expected a map")
+	}
+
+	op, _ := m["op"].(string)
+	path, ok := m["path"].(string)
+	if !ok {
+		return patchOperation{Op: op}, fmt.Errorf("'path' is required")
+	}
+	from, _ := m["from"].(string)
+
+	// Check for the value and from fields.
+	value, hasValue := m["value"]
+	switch op {
+	case "add", "replace", "test":
+		if !hasValue {
+			return patchOperation{Op: op, Path: path}, fmt.Errorf("'value' is required")
+		}
+	case "move", "copy":
+		if _, ok := m["from"]; !ok {
+			return patchOperation{Op: op, Path: path}, fmt.Errorf("'from' is required")
+		}
+	case "remove":
+	default:
+		return patchOperation{Op: op, Path: path}, fmt.Errorf("unknown operation")
+	}
+
+	return patchOperation{op, path, from, value}, nil
+}
+
+func (c *ConfigSpec) applyPatchOperation(name string, config any, op patchOperation) (any, error) {
+	path, err := parseJSONPointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add", "replace":
+		config, err = pointerSet(config, path, op.Value, op.Op == "replace")
+		if err == nil {
+			c.recordPatch(name, config, path, false)
+		}
+		return config, err
+	case "remove":
+		config, err = pointerRemove(config, path)
+		if err == nil {
+			c.recordPatch(name, config, path, true)
+		}
+		return config, err
+	case "move", "copy":
+		from, err := parseJSONPointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		value, ok := lookupKeyPath(config, from)
+		if !ok {
+			return nil, fmt.Errorf("path '%s' not found", op.From)
+		}
+		if op.Op == "move" {
+			if config, err = pointerRemove(config, from); err != nil {
+				return nil, err
+			}
+			c.recordPatch(name, config, from, true)
+		}
+		config, err = pointerSet(config, path, value, false)
+		if err == nil {
+			c.recordPatch(name, config, path, false)
+		}
+		return config, err
+	default:
+		value, ok := lookupKeyPath(config, path)
+		if !ok {
+			return nil, fmt.Errorf("path not found")
+		}
+		if !reflect.DeepEqual(value, op.Value) {
+			return nil, fmt.Errorf("test failed: value is %s", formatConfigValue(value))
+		}
+		return config, nil
+	}
+}
+
+func (c *ConfigSpec) recordPatch(name string, config any, path []string, removed bool) {
+	// Forget all the sources when the whole config is replaced.
+	if len(path) == 0 {
+		c.provenance = make(map[string][]string)
+	}
+
+	// Lists are recorded as a whole, so find the nearest key that is not in
+	// a list.
+	v := config
+	for i, key := range path {
+		m, ok := v.(map[string]any)
+		if !ok {
+			keyPath := strings.Join(path[:i], ".")
+			c.forget(keyPath)
+			c.provenance[keyPath] = []string{name}
+			return
+		}
+		v = m[key]
+	}
+
+	// Record the patched value.
+	keyPath := strings.Join(path, ".")
+	c.forget(keyPath)
+	if m, ok := v.(map[string]any); ok && len(m) > 0 {
+		c.record(keyPath, m, []string{name})
+	} else if !removed {
+		c.provenance[keyPath] = []string{name}
+	}
+}
+
+func parseJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("path '%s' must start with '/'", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+
+	return tokens, nil
+}
+
+func pointerSet(v any, path []string, value any, replace bool) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	key := path[0]
+	switch t := v.(type) {
+	case map[string]any:
+		child, ok := t[key]
+		if !ok && (replace || len(path) > 1) {
+			return nil, fmt.Errorf("key '%s' not found", key)
+		}
+
+		if len(path) > 1 {
+			var err error
+			if value, err = pointerSet(child, path[1:], value, replace); err != nil {
+				return nil, err
+			}
+		}
+
+		out := make(map[string]any, len(t)+1)
+		for k, v := range t {
+			out[k] = v
+		}
+		out[key] = value
+		return out, nil
+	case []any:
+		// The dash appends to a list.
+		i := len(t)
+		if key != "-" || replace || len(path) > 1 {
+			var err error
+			if i, err = strconv.Atoi(key); err != nil || i < 0 || i > len(t) || (i == len(t) && (replace || len(path) > 1)) {
+				return nil, fmt.Errorf("index '%s' out of range", key)
+			}
+		}
+
+		out := make([]any, 0, len(t)+1)
+		out = append(out, t[:i]...)
+		switch {
+		case len(path) > 1:
+			child, err := pointerSet(t[i], path[1:], value, replace)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, child)
+			out = append(out, t[i+1:]...)
+		case replace:
+			out = append(out, value)
+			out = append(out, t[i+1:]...)
+		default:
+			out = append(out, value)
+			out = append(out, t[i:]...)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("key '%s' not found", key)
+	}
+}
+
+func pointerRemove(v any, path []string) (any, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("cannot remove the root")
+	}
+
+	key := path[0]
+	switch t := v.(type) {
+	case map[string]any:
+		child, ok := t[key]
+		if !ok {
+			return nil, fmt.Errorf("key '%s' not found", key)
+		}
+
+		out := make(map[string]any, len(t))
+		for k, v := range t {
+			out[k] = v
+		}
+		if len(path) == 1 {
+			delete(out, key)
+		} else {
+			updated, err := pointerRemove(child, path[1:])
+			if err != nil {
+				return nil, err
+			}
+			out[key] = updated
+		}
+		return out, nil
+	case []any:
+		i, err := strconv.Atoi(key)
+		if err != nil || i < 0 || i >= len(t) {
+			return nil, fmt.Errorf("index '%s' out of range", key)
+		}
+
+		out := make([]any, 0, len(t))
+		out = append(out, t[:i]...)
+		if len(path) > 1 {
+			updated, err := pointerRemove(t[i], path[1:])
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, updated)
+		}
+		out = append(out, t[i+1:]...)
+		return out, nil
+	default:
+		return nil, fmt.Errorf("key '%s' not found", key)
+	}
+}
@@ -0,0 +1,152 @@
+package internal
+
+import (
+	"path"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewConfigSpecWithJSONPatch(t *testing.T) {
+	t.Parallel()
+
+	// Prepare the test.
+	th := NewTestHarness(t, afero.NewMemMapFs())
+	dir := th.TempDir()
+
+	// Write the config file.
+	config := path.Join(dir, "config.yml")
+	th.WriteFileString(config, `Config:
+  Registry: "docker.io"
+  Image: "${Registry}/app"
+  Debug: true
+  Packages: [git, curl]
+  Old:
+    Name: "old"`)
+
+	// Write the patch file.
+	patch := path.Join(dir, "patch.yml")
+	th.WriteFileString(patch, `- op: test
+  path: /Debug
+  value: true
+- op: replace
+  path: /Registry
+  value: "ghcr.io"
+- op: remove
+  path: /Debug
+- op: add
+  path: /Packages/-
+  value: wget
+- op: add
+  path: /Packages/0
+  value: ca-certificates
+- op: move
+  from: /Old
+  path: /New
+- op: copy
+  from: /New/Name
+  path: /Name~1Copy`)
+
+	opts := DefaultOptions()
+	opts.ConfigPatches = []string{patch}
+	spec := th.NewConfigSpecWithOptions(opts, config)
+	assert.Equal(t, map[string]any{
+		"Registry":  "ghcr.io",
+		"Image":     "ghcr.io/app",
+		"Packages":  []any{"ca-certificates", "git", "curl", "wget"},
+		"New":       map[string]any{"Name": "old"},
+		"Name/Copy": "old",
+	}, spec.config)
+
+	// Check the provenance of the patched keys.
+	assert.Equal(t, []ConfigSource{
+		{Key: "Image", Value: "ghcr.io/app", Files: []string{config}},
+		{Key: "Name/Copy", Value: "old", Files: []string{patch}},
+		{Key: "New.Name", Value: "old", Files: []string{patch}},
+		{Key: "Packages", Value: []any{"ca-certificates", "git", "curl", "wget"}, Files: []string{patch}},
+		{Key: "Registry", Value: "ghcr.io", Files: []string{patch}},
+	}, spec.Sources())
+}
+
+func TestNewConfigSpecWithMergePatch(t *testing.T) {
+	t.Parallel()
+
+	// Prepare the test.
+	th := NewTestHarness(t, afero.NewMemMapFs())
+	dir := th.TempDir()
+
+	// Write the config file.
+	config := path.Join(dir, "config.yml")
+	th.WriteFileString(config, `Config:
+  Registry: "docker.io"
+  Debug: true
+  Go:
+    Version: "1.22"
+    Packages: [a]`)
+
+	// Write the patch file.
+	patch := path.Join(dir, "patch.yml")
+	th.WriteFileString(patch, `Registry: "ghcr.io"
+Debug: null
+Go:
+  Packages: [b]`)
+
+	opts := DefaultOptions()
+	opts.ConfigPatches = []string{patch}
+	spec := th.NewConfigSpecWithOptions(opts, config)
+	assert.Equal(t, map[string]any{
+		"Registry": "ghcr.io",
+		"Go": map[string]any{
+			"Version":  "1.22",
+			"Packages": []any{"b"},
+		},
+	}, spec.config)
+	assert.Equal(t, []ConfigSource{
+		{Key: "Go.Packages", Value: []any{"b"}, Files: []string{patch}},
+		{Key: "Go.Version", Value: "1.22", Files: []string{config}},
+		{Key: "Registry", Value: "ghcr.io", Files: []string{patch}},
+	}, spec.Sources())
+}
+
+func TestNewConfigSpecWhenPatchInvalid(t *testing.T) {
+	t.Parallel()
+
+	// Prepare the test.
+	th := NewTestHarness(t, afero.NewMemMapFs())
+	dir := th.TempDir()
+
+	// Write the config file.
+	config := path.Join(dir, "config.yml")
+	th.WriteFileString(config, "Config:\n  Name: app\n  Packages: [git]")
+
+	tests := map[string]string{
+		"replace missing key":  "[{op: replace, path: /Missing, value: x}]",
+		"add to missing map":   "[{op: add, path: /Missing/Name, value: x}]",
+		"remove out of range":  "[{op: remove, path: /Packages/1}]",
+		"invalid pointer":      "[{op: remove, path: Name}]",
+		"test failed":          "[{op: test, path: /Name, value: other}]",
+		"unknown operation":    "[{op: delete, path: /Name}]",
+		"missing value":        "[{op: add, path: /Name}]",
+		"replace root":         "[{op: replace, path: '', value: [1]}]",
+		"scalar patch":         "patch",
+		"operation not a map":  "[remove]",
+		"missing path":         "[{op: remove}]",
+		"move from missing":    "[{op: move, from: /Missing, path: /Name}]",
+		"add index not number": "[{op: add, path: /Packages/x, value: x}]",
+	}
+
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			patch := path.Join(dir, name+".yml")
+			th.WriteFileString(patch, content)
+
+			opts := DefaultOptions()
+			opts.ConfigPatches = []string{patch}
+			_, err := NewConfigSpec(th.fs, nil, []string{config}, opts)
+			require.ErrorIs(t, err, ErrConfigPatch)
+			assert.Contains(t, err.Error(), patch)
+		})
+	}
+}
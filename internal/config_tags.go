@@ -0,0 +1,134 @@
+package internal
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var configTags = []string{"!base64file", "!env", "!file", "!include", secretTag}
+
+func (c *ConfigSpec) resolveTags(name string, node *yaml.Node, includes []string, readFile func(string) ([]byte, error)) error {
+	// Resolve the tags of the children.
+	if node.Kind != yaml.ScalarNode {
+		for _, child := range node.Content {
+			if err := c.resolveTags(name, child, includes, readFile); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Skip scalars without a custom tag.
+	if !slices.Contains(configTags, node.Tag) {
+		return nil
+	}
+
+	// Check that the tag is permitted.
+	if !c.tagAllowed(node.Tag) {
+		return fmt.Errorf("%w: %s:%d: tag %s is not allowed", ErrConfigTag, name, node.Line, node.Tag)
+	}
+
+	switch node.Tag {
+	case "!env":
+		value, ok := os.LookupEnv(node.Value)
+		if !ok {
+			return fmt.Errorf("%w: %s:%d: environment variable '%s' is not set", ErrConfigTag, name, node.Line, node.Value)
+		}
+		setStringNode(node, value)
+	case "!file":
+		b, err := c.readTagFile(name, node, readFile)
+		if err != nil {
+			return err
+		}
+		setStringNode(node, string(b))
+	case "!base64file":
+		b, err := c.readTagFile(name, node, readFile)
+		if err != nil {
+			return err
+		}
+		setStringNode(node, base64.StdEncoding.EncodeToString(b))
+	case "!include":
+		return c.includeTagFile(name, node, includes, readFile)
+	}
+
+	// Secrets are decrypted later.
+	return nil
+}
+
+func (c *ConfigSpec) tagAllowed(tag string) bool {
+	if c.options.ConfigTags == nil {
+		return true
+	}
+
+	for _, allowed := range c.options.ConfigTags {
+		if "!"+strings.TrimPrefix(allowed, "!") == tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *ConfigSpec) readTagFile(name string, node *yaml.Node, readFile func(string) ([]byte, error)) ([]byte, error) {
+	// Paths are relative to the config file.
+	filename := node.Value
+	if !filepath.IsAbs(filename) {
+		filename = filepath.Join(filepath.Dir(name), filename)
+	}
+
+	b, err := readFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s:%d: %s %s: %w", ErrConfigTag, name, node.Line, node.Tag, filename, err)
+	}
+
+	return b, nil
+}
+
+func (c *ConfigSpec) includeTagFile(name string, node *yaml.Node, includes []string, readFile func(string) ([]byte, error)) error {
+	b, err := c.readTagFile(name, node, readFile)
+	if err != nil {
+		return err
+	}
+
+	// Check for an include cycle.
+	filename := node.Value
+	if !filepath.IsAbs(filename) {
+		filename = filepath.Join(filepath.Dir(name), filename)
+	}
+	if slices.Contains(includes, filename) {
+		cycle := append(slices.Clone(includes), filename)
+		return fmt.Errorf("%w: %s", ErrConfigCycle, strings.Join(cycle, " -> "))
+	}
+
+	// Parse the included file.
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return fmt.Errorf("%w: %s:%d: %s %s: %w", ErrConfigTag, name, node.Line, node.Tag, filename, err)
+	}
+
+	// Resolve the tags in the included file relative to that file.
+	if err := c.resolveTags(filename, &doc, append(slices.Clone(includes), filename), readFile); err != nil {
+		return err
+	}
+
+	// Replace the node with the included value.
+	if len(doc.Content) == 0 {
+		*node = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Line: node.Line, Column: node.Column}
+	} else {
+		*node = *doc.Content[0]
+	}
+
+	return nil
+}
+
+func setStringNode(node *yaml.Node, value string) {
+	node.Tag = "!!str"
+	node.Style = yaml.DoubleQuotedStyle
+	node.Value = value
+}
@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"path"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewConfigSpecWithTags(t *testing.T) {
+	t.Setenv("TMPL_TEST_TOKEN", "token")
+
+	// Prepare the test.
+	th := NewTestHarness(t, afero.NewMemMapFs())
+	dir := th.TempDir()
+	th.WriteFileString(path.Join(dir, "certs", "ca.pem"), "-----BEGIN CERTIFICATE-----\n")
+	th.WriteFileString(path.Join(dir, "logo.png"), "\x89PNG")
+	th.WriteFileString(path.Join(dir, "schemas", "other.yml"), "Type: object\nDescription: !file ../README")
+	th.WriteFileString(path.Join(dir, "README"), "Read me")
+
+	// Write the config file.
+	config := path.Join(dir, "config.yml")
+	th.WriteFileString(config, `Config:
+  Certificate: !file ./certs/ca.pem
+  Token: !env TMPL_TEST_TOKEN
+  Schema: !include schemas/other.yml
+  Logo: !base64file logo.png`)
+
+	spec := th.NewConfigSpec(config)
+	assert.Equal(t, map[string]any{
+		"Certificate": "-----BEGIN CERTIFICATE-----\n",
+		"Token":       "token",
+		"Schema": map[string]any{
+			"Type":        "object",
+			"Description": "Read me",
+		},
+		"Logo": "iVBORw==",
+	}, spec.config)
+}
+
+func TestNewConfigSpecWhenTagInvalid(t *testing.T) {
+	t.Parallel()
+
+	// Prepare the test.
+	th := NewTestHarness(t, afero.NewMemMapFs())
+	dir := th.TempDir()
+	th.WriteFileString(path.Join(dir, "cycle.yml"), "Self: !include cycle.yml")
+
+	tests := []struct {
+		name     string
+		value    string
+		expected error
+		contains string
+	}{
+		{"missing file", "!file missing.txt", ErrConfigTag, path.Join(dir, "missing.txt")},
+		{"missing base64 file", "!base64file missing.png", ErrConfigTag, path.Join(dir, "missing.png")},
+		{"missing include", "!include missing.yml", ErrConfigTag, path.Join(dir, "missing.yml")},
+		{"missing variable", "!env TMPL_TEST_MISSING", ErrConfigTag, "environment variable 'TMPL_TEST_MISSING' is not set"},
+		{"include cycle", "!include cycle.yml", ErrConfigCycle, "cycle.yml -> " + path.Join(dir, "cycle.yml")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := path.Join(dir, test.name+".yml")
+			th.WriteFileString(config, "Config:\n  Value: "+test.value)
+
+			_, err := NewConfigSpec(th.fs, nil, []string{config}, DefaultOptions())
+			require.ErrorIs(t, err, test.expected)
+			assert.Contains(t, err.Error(), test.contains)
+		})
+	}
+}
+
+func TestNewConfigSpecWhenTagNotAllowed(t *testing.T) {
+	t.Parallel()
+
+	// Prepare the test.
+	th := NewTestHarness(t, afero.NewMemMapFs())
+	dir := th.TempDir()
+	th.WriteFileString(path.Join(dir, "a.txt"), "a")
+
+	// Write the config file.
+	config := path.Join(dir, "config.yml")
+	th.WriteFileString(config, "Config:\n  A: !file a.txt\n  B: !env HOME")
+
+	// Permit only the file tag.
+	opts := DefaultOptions()
+	opts.ConfigTags = []string{"file"}
+	_, err := NewConfigSpec(th.fs, nil, []string{config}, opts)
+	require.ErrorIs(t, err, ErrConfigTag)
+	assert.Contains(t, err.Error(), config+":3: tag !env is not allowed")
+
+	// Permit no tags.
+	opts.ConfigTags = []string{}
+	_, err = NewConfigSpec(th.fs, nil, []string{config}, opts)
+	require.ErrorIs(t, err, ErrConfigTag)
+	assert.Contains(t, err.Error(), config+":2: tag !file is not allowed")
+}
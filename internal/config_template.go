@@ -0,0 +1,64 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+)
+
+const configTemplateHeader = "Template: true"
+
+func isConfigTemplate(name string) bool {
+	return strings.HasSuffix(name, ".tmpl.yml") || strings.HasSuffix(name, ".tmpl.yaml")
+}
+
+func cutConfigTemplateHeader(b []byte) ([]byte, bool) {
+	// Find the first line that is not blank or a comment.
+	offset := 0
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := scanner.Text()
+		next := offset + len(line) + 1
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			offset = next
+			continue
+		}
+
+		// Remove the header so that it does not become part of the config.
+		if trimmed == configTemplateHeader {
+			out := append([]byte{}, b[:offset]...)
+			if next < len(b) {
+				out = append(out, b[next:]...)
+			}
+			return out, true
+		}
+
+		break
+	}
+
+	return b, false
+}
+
+func (c *ConfigSpec) render(name string, b []byte) ([]byte, error) {
+	// Create and parse the template with the same functions as other
+	// templates.
+	cache := NewTemplateCache(c.mounts, c.options)
+	cache.configSpec = c
+	funcs := NewFunctions(name, c.mounts, cache)
+	t, err := newTemplate(name, c.options).Funcs(funcs.FuncMap()).Parse(string(b))
+	if err != nil {
+		return nil, err
+	}
+
+	// Execute the template with a copy of the config merged so far.
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, mergeMaps(c.config, nil)); err != nil {
+		return nil, err
+	}
+
+	// Remember the files read through the mounts.
+	c.dependencies = append(c.dependencies, cache.Dependencies()...)
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"path"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCutConfigTemplateHeader(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in       string
+		expected string
+		header   bool
+	}{
+		{"Template: true\nConfig: {}", "Config: {}", true},
+		{"# comment\n\nTemplate: true\nConfig: {}\n", "# comment\n\nConfig: {}\n", true},
+		{"Template: true", "", true},
+		{"Config: {}\nTemplate: true", "Config: {}\nTemplate: true", false},
+		{"Template: false\nConfig: {}", "Template: false\nConfig: {}", false},
+	}
+
+	for _, test := range tests {
+		out, header := cutConfigTemplateHeader([]byte(test.in))
+		assert.Equal(t, test.expected, string(out))
+		assert.Equal(t, test.header, header)
+	}
+}
+
+func TestNewConfigSpecWithTemplates(t *testing.T) {
+	t.Parallel()
+
+	// Prepare the test.
+	th := NewTestHarness(t, afero.NewMemMapFs())
+	dir := th.TempDir()
+	th.WriteFileString(path.Join(dir, "VERSION"), "1.2.3\n")
+
+	// Write an ordinary config file.
+	config1 := path.Join(dir, "config.yml")
+	th.WriteFileString(config1, `Config:
+  Registry: "ghcr.io"
+  Name: "app"`)
+
+	// Write config templates using both conventions.
+	config2 := path.Join(dir, "image.tmpl.yml")
+	th.WriteFileString(config2, `Config:
+  Image: "{{ .Registry }}/{{ .Name | upper }}:{{ includeText "/target/VERSION" | trim }}"`)
+
+	config3 := path.Join(dir, "hash.yml")
+	th.WriteFileString(config3, `# Computed values.
+Template: true
+Config:
+  Hash: "{{ .Image | sha256sum | trunc 8 }}"`)
+
+	mounts := th.NewMounts(dir + ":/target")
+	spec, err := NewConfigSpec(th.fs, mounts, []string{config1, config2, config3}, DefaultOptions())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{
+		"Registry": "ghcr.io",
+		"Name":     "app",
+		"Image":    "ghcr.io/APP:1.2.3",
+		"Hash":     "24f0cef8",
+	}, spec.config)
+}
+
+func TestNewConfigSpecWhenTemplateInvalid(t *testing.T) {
+	t.Parallel()
+
+	// Prepare the test.
+	th := NewTestHarness(t, afero.NewMemMapFs())
+	config := path.Join(th.TempDir(), "config.tmpl.yml")
+	th.WriteFileString(config, "Config:\n  Image: {{ .Missing }}")
+
+	_, err := NewConfigSpec(th.fs, nil, []string{config}, DefaultOptions())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "map has no entry for key \"Missing\"")
+}
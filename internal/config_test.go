@@ -2,10 +2,12 @@ package internal
 
 import (
 	"path"
+	"strings"
 	"testing"
 
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewConfigSpec(t *testing.T) {
@@ -79,3 +81,280 @@ func TestMergeMaps(t *testing.T) {
 		},
 	}, result)
 }
+
+func TestNewConfigSpecWithImports(t *testing.T) {
+	t.Parallel()
+
+	// Prepare the test.
+	th := NewTestHarness(t, afero.NewMemMapFs())
+	dir := th.TempDir()
+	th.Mkdir(path.Join(dir, "lang"), 0755)
+	th.Mkdir(path.Join(dir, "product"), 0755)
+
+	// Write the imported config files.
+	th.WriteFileString(path.Join(dir, "base.yml"), `Config:
+  BaseImage: "ubuntu:24.04"
+  LanguageCode: "en"`)
+	th.WriteFileString(path.Join(dir, "lang", "a.yml"), `Config:
+  Languages:
+    A: true`)
+	th.WriteFileString(path.Join(dir, "lang", "b.yml"), `Config:
+  Languages:
+    B: true`)
+
+	// Write the importing config file.
+	config := path.Join(dir, "product", "config.yml")
+	th.WriteFileString(config, `Imports:
+  - ../base.yml
+  - ../lang/**/*.{yml,yaml}
+Config:
+  LanguageCode: "fr"`)
+
+	spec := th.NewConfigSpec(config)
+	assert.Equal(t, map[string]any{
+		"BaseImage":    "ubuntu:24.04",
+		"LanguageCode": "fr",
+		"Languages": map[string]any{
+			"A": true,
+			"B": true,
+		},
+	}, spec.config)
+
+	// Check the provenance of the keys.
+	assert.Equal(t, []ConfigSource{
+		{
+			Key:   "BaseImage",
+			Value: "ubuntu:24.04",
+			Files: []string{config, path.Join(dir, "base.yml")},
+		},
+		{
+			Key:   "LanguageCode",
+			Value: "fr",
+			Files: []string{config},
+		},
+		{
+			Key:   "Languages.A",
+			Value: true,
+			Files: []string{config, path.Join(dir, "lang", "a.yml")},
+		},
+		{
+			Key:   "Languages.B",
+			Value: true,
+			Files: []string{config, path.Join(dir, "lang", "b.yml")},
+		},
+	}, spec.Sources())
+}
+
+func TestNewConfigSpecWhenImportCycle(t *testing.T) {
+	t.Parallel()
+
+	// Prepare the test.
+	th := NewTestHarness(t, afero.NewMemMapFs())
+	dir := th.TempDir()
+
+	// Write config files that import each other.
+	config1 := path.Join(dir, "config1.yml")
+	th.WriteFileString(config1, "Imports: [config2.yml]\nConfig: {}")
+	config2 := path.Join(dir, "config2.yml")
+	th.WriteFileString(config2, "Imports: [config1.yml]\nConfig: {}")
+
+	_, err := NewConfigSpec(th.fs, nil, []string{config1}, DefaultOptions())
+	require.ErrorIs(t, err, ErrConfigCycle)
+	assert.Contains(t, err.Error(), config1+" -> "+config2+" -> "+config1)
+}
+
+func TestConfigSourceString(t *testing.T) {
+	t.Parallel()
+
+	source := ConfigSource{
+		Key:   "Image",
+		Value: "app",
+		Files: []string{"config.yml", "base.yml"},
+	}
+	assert.Equal(t, "Image: \"app\"\n  set in base.yml\n  imported by config.yml", source.String())
+}
+
+func TestNewConfigSpecWithProfiles(t *testing.T) {
+	t.Parallel()
+
+	// Prepare the test.
+	th := NewTestHarness(t, afero.NewMemMapFs())
+	dir := th.TempDir()
+
+	// Write the config file with profiles.
+	config := path.Join(dir, "config.yml")
+	th.WriteFileString(config, `Config:
+  Replicas: 1
+  Registry: "localhost"
+  Debug: true
+Profiles:
+  prod:
+    Replicas: 3
+    Registry: "ghcr.io"
+    Debug: false
+  eu:
+    Registry: "eu.ghcr.io"`)
+
+	opts := DefaultOptions()
+	opts.Profiles = []string{"prod", "eu"}
+	spec := th.NewConfigSpecWithOptions(opts, config)
+	assert.Equal(t, map[string]any{
+		"Replicas": 3,
+		"Registry": "eu.ghcr.io",
+		"Debug":    false,
+	}, spec.config)
+
+	// Profiles are applied in the given order.
+	opts.Profiles = []string{"eu", "prod"}
+	spec = th.NewConfigSpecWithOptions(opts, config)
+	assert.Equal(t, "ghcr.io", spec.config["Registry"])
+}
+
+func TestNewConfigSpecWhenProfileUnknown(t *testing.T) {
+	t.Parallel()
+
+	// Prepare the test.
+	th := NewTestHarness(t, afero.NewMemMapFs())
+	config := path.Join(th.TempDir(), "config.yml")
+	th.WriteFileString(config, "Config: {}\nProfiles:\n  prod: {}")
+
+	opts := DefaultOptions()
+	opts.Profiles = []string{"prod", "staging"}
+	_, err := NewConfigSpec(th.fs, nil, []string{config}, opts)
+	require.ErrorIs(t, err, ErrConfigProfileUnknown)
+	assert.Contains(t, err.Error(), "staging")
+}
+
+func TestNewConfigSpecWithNamespaces(t *testing.T) {
+	t.Parallel()
+
+	// Prepare the test.
+	th := NewTestHarness(t, afero.NewMemMapFs())
+	dir := th.TempDir()
+	th.Mkdir(path.Join(dir, "data"), 0755)
+
+	// Write the ordinary config file.
+	config := path.Join(dir, "config.yml")
+	th.WriteFileString(config, `Config:
+  Name: "product"`)
+
+	// Write the data files without the Config element.
+	services := path.Join(dir, "services.yml")
+	th.WriteFileString(services, `Name: "services"
+Ports: [80, 443]`)
+	th.WriteFileString(path.Join(dir, "data", "a.yml"), `Name: "a"`)
+	th.WriteFileString(path.Join(dir, "data", "b.yaml"), `- b`)
+	th.WriteFileString(path.Join(dir, "data", "ignored.txt"), `ignored`)
+
+	spec := th.NewConfigSpec(config, "services="+services, "all.data="+path.Join(dir, "data"))
+	assert.Equal(t, map[string]any{
+		"Name": "product",
+		"services": map[string]any{
+			"Name":  "services",
+			"Ports": []any{80, 443},
+		},
+		"all": map[string]any{
+			"data": map[string]any{
+				"a": map[string]any{"Name": "a"},
+				"b": []any{"b"},
+			},
+		},
+	}, spec.config)
+}
+
+func TestNewConfigSpecWithNamespaceReplacesValue(t *testing.T) {
+	t.Parallel()
+
+	// Prepare the test.
+	th := NewTestHarness(t, afero.NewMemMapFs())
+	dir := th.TempDir()
+
+	// Write the config file with a value under the namespace.
+	config := path.Join(dir, "config.yml")
+	th.WriteFileString(config, `Config:
+  services:
+    Old: true`)
+
+	// Write the data file.
+	services := path.Join(dir, "services.yml")
+	th.WriteFileString(services, `New: true`)
+
+	spec := th.NewConfigSpec(config, "services="+services)
+	assert.Equal(t, map[string]any{
+		"services": map[string]any{"New": true},
+	}, spec.config)
+	assert.Equal(t, []ConfigSource{
+		{Key: "services.New", Value: true, Files: []string{services}},
+	}, spec.Sources())
+}
+
+func TestNewConfigSpecWithDirectory(t *testing.T) {
+	t.Parallel()
+
+	// Prepare the test.
+	th := NewTestHarness(t, afero.NewMemMapFs())
+	dir := th.TempDir()
+
+	// Write the config files in the reverse of name order.
+	th.WriteFileString(path.Join(dir, "2-product.yml"), "Config:\n  Name: product")
+	th.WriteFileString(path.Join(dir, "1-base.yml"), "Config:\n  Name: base\n  Base: true")
+
+	spec := th.NewConfigSpec(dir + "/")
+	assert.Equal(t, map[string]any{
+		"Name": "product",
+		"Base": true,
+	}, spec.config)
+}
+
+func TestNewConfigSpecWithMultipleDocuments(t *testing.T) {
+	t.Parallel()
+
+	// Prepare the test.
+	th := NewTestHarness(t, afero.NewMemMapFs())
+	dir := th.TempDir()
+
+	// Write a file with multiple documents.
+	config := path.Join(dir, "config.yml")
+	th.WriteFileString(config, `Config:
+  Name: "first"
+  First: true
+---
+---
+Config:
+  Name: "second"
+  Second: true
+`)
+
+	// Write a data file with multiple documents.
+	services := path.Join(dir, "services.yml")
+	th.WriteFileString(services, "A: a\n---\nB: b\n")
+
+	spec := th.NewConfigSpec(config, "services="+services)
+	assert.Equal(t, map[string]any{
+		"Name":   "second",
+		"First":  true,
+		"Second": true,
+		"services": map[string]any{
+			"A": "a",
+			"B": "b",
+		},
+	}, spec.config)
+}
+
+func TestNewConfigSpecFromStdin(t *testing.T) {
+	t.Parallel()
+
+	// Prepare the test.
+	th := NewTestHarness(t, afero.NewMemMapFs())
+	config := path.Join(th.TempDir(), "config.yml")
+	th.WriteFileString(config, "Config:\n  Name: file\n  File: true")
+
+	opts := DefaultOptions()
+	opts.Stdin = strings.NewReader("Config:\n  Name: stdin\n---\nConfig:\n  Piped: true\n")
+	spec := th.NewConfigSpecWithOptions(opts, config, "-")
+	assert.Equal(t, map[string]any{
+		"Name":  "stdin",
+		"File":  true,
+		"Piped": true,
+	}, spec.config)
+}
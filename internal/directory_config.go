@@ -0,0 +1,151 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+
+	"github.com/spf13/afero"
+)
+
+const directoryConfigName = "_config.yml"
+
+func (cache *TemplateCache) directoryData(dir string, data any) (any, error) {
+	// Get the merged config for the directory.
+	config, err := cache.directoryConfig(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// Directory configs are defaults for the data given to the template.
+	switch t := data.(type) {
+	case nil:
+		if len(config) > 0 {
+			return mergeMaps(config, nil), nil
+		}
+		return nil, nil
+	case map[string]any:
+		// Apply the defaults to the data given by the user rather than to data
+		// that already has the defaults of another directory, so that the
+		// nearest directory wins for included templates.
+		t = cache.userData(t)
+		if len(config) > 0 {
+			merged := mergeMaps(config, t)
+			cache.configMutex.Lock()
+			cache.defaulted[reflect.ValueOf(merged).Pointer()] = defaultedData{merged, t}
+			cache.configMutex.Unlock()
+			return merged, nil
+		}
+		return t, nil
+	default:
+		return data, nil
+	}
+}
+
+type defaultedData struct {
+	// Keep the data so that its address is not reused by another map.
+	data map[string]any
+	user map[string]any
+}
+
+func (cache *TemplateCache) userData(data map[string]any) map[string]any {
+	// Look up the data given by the user before the defaults were applied.
+	cache.configMutex.Lock()
+	defer cache.configMutex.Unlock()
+
+	if defaulted, ok := cache.defaulted[reflect.ValueOf(data).Pointer()]; ok {
+		return defaulted.user
+	}
+
+	return data
+}
+
+func (cache *TemplateCache) directoryConfig(dir string) (map[string]any, error) {
+	// Check if the directory config is cached.
+	cache.configMutex.Lock()
+	config, ok := cache.configs[dir]
+	cache.configMutex.Unlock()
+	if ok {
+		return config, nil
+	}
+
+	// Start with the config of the parent directory so that the nearest
+	// directory takes precedence.
+	config = map[string]any{}
+	if parent := path.Dir(dir); parent != dir {
+		parentConfig, err := cache.directoryConfig(parent)
+		if err != nil {
+			return nil, err
+		}
+		config = parentConfig
+	}
+
+	// Merge the config file in the directory, if any.
+	name := path.Join(dir, directoryConfigName)
+	b, err := cache.readFile(name)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	} else if err == nil {
+		dirConfig, err := cache.directoryConfigSpec().decodeDirectoryConfig(name, b, cache.readFile)
+		if err != nil {
+			return nil, err
+		}
+		config = mergeMaps(config, dirConfig)
+	}
+
+	// Save the config for reuse.
+	cache.configMutex.Lock()
+	cache.configs[dir] = config
+	cache.configMutex.Unlock()
+
+	return config, nil
+}
+
+func (cache *TemplateCache) directoryConfigSpec() *ConfigSpec {
+	// Decode directory configs with the config spec of the templates, so
+	// that warnings and secrets are reported with the other config files.
+	if cache.configSpec != nil {
+		return cache.configSpec
+	}
+
+	return &ConfigSpec{fs: afero.NewOsFs(), mounts: cache.mounts, options: cache.options}
+}
+
+func (c *ConfigSpec) decodeDirectoryConfig(name string, b []byte, readFile func(string) ([]byte, error)) (map[string]any, error) {
+	// Parse the documents like other config files.
+	docs, err := c.parseDocuments(name, b, readFile)
+	if err != nil {
+		return nil, err
+	}
+	if len(docs) == 0 {
+		return nil, fmt.Errorf("%w: %s: required field '%s' not found", ErrConfigInvalid, name, "Config")
+	}
+
+	config := map[string]any{}
+	for _, doc := range docs {
+		// Rewrite renamed and removed keys.
+		if err := c.migrate(name, doc); err != nil {
+			return nil, err
+		}
+
+		var data ConfigSpecData
+		if err := doc.node.Decode(&data); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if data.Config == nil {
+			return nil, fmt.Errorf("%w: %s: required field '%s' not found", ErrConfigInvalid, name, "Config")
+		}
+		config = mergeMaps(config, data.Config)
+
+		// Overlay the selected profiles in order.
+		for _, profile := range c.options.Profiles {
+			if profileConfig, ok := data.Profiles[profile]; ok {
+				config = mergeMaps(config, profileConfig)
+			}
+		}
+	}
+
+	return config, nil
+}
@@ -0,0 +1,118 @@
+package internal
+
+import (
+	"path"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteWithDirectoryConfigs(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+	th := NewTestHarness(t, fs)
+	dir := th.TempDir()
+
+	// Write the directory configs.
+	th.WriteFileString(path.Join(dir, "_config.yml"), "Config:\n  User: root\n  Shell: sh")
+	th.WriteFileString(path.Join(dir, "modules", "_config.yml"), "Config:\n  User: module")
+	th.WriteFileString(path.Join(dir, "modules", "git", "_config.yml"), "Config:\n  Package: git")
+
+	// Write the templates.
+	th.WriteFileString(path.Join(dir, "Dockerfile.tmpl"), `{{ .User }} {{ .Shell }}
+{{ range .Modules }}{{ include (printf "/modules/%s/module.tmpl" .) $ }}{{ end }}`)
+	th.WriteFileString(path.Join(dir, "modules", "git", "module.tmpl"), "{{ .Package }} {{ .User }} {{ .Shell }} {{ include \"shell.tmpl\" nil }}\n")
+	th.WriteFileString(path.Join(dir, "modules", "git", "shell.tmpl"), "{{ .Shell }}")
+	th.WriteFileString(path.Join(dir, "modules", "curl", "module.tmpl"), "{{ .User }}\n")
+
+	configFilename := path.Join(th.TempDir(), "config.yaml")
+	th.WriteFileString(configFilename, "Config:\n  Shell: bash\n  Modules: [git, curl]")
+
+	outFilename := path.Join(th.TempDir(), "out")
+	s, _ := th.ExecuteString("/Dockerfile.tmpl", []string{dir + "/:/"}, []string{configFilename}, outFilename, DefaultOptions())
+
+	// Check that the config files take precedence over the directory configs,
+	// and that the nearest directory config wins for other data.
+	assert.Equal(t, "root bash\ngit module bash sh\nmodule\n", s)
+}
+
+func TestExecuteWithDirectoryConfigsWhenIncluded(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+	th := NewTestHarness(t, fs)
+	dir := th.TempDir()
+
+	th.WriteFileString(path.Join(dir, "_config.yml"), "Config:\n  Name: root\n  Shell: sh")
+	th.WriteFileString(path.Join(dir, "modules", "git", "_config.yml"), "Config:\n  Name: git")
+	th.WriteFileString(path.Join(dir, "main.tmpl"), `main={{ .Name }} {{ include "/t/modules/git/m.tmpl" . }}`)
+	th.WriteFileString(path.Join(dir, "modules", "git", "m.tmpl"), `git={{ .Name }} {{ .Shell }} {{ include "/t/footer.tmpl" . }}`)
+	th.WriteFileString(path.Join(dir, "footer.tmpl"), `footer={{ .Name }} {{ .User }}`)
+
+	configFilename := path.Join(th.TempDir(), "config.yml")
+	th.WriteFileString(configFilename, "Config:\n  User: app")
+
+	// Check that the directory of each included template applies its own
+	// defaults to the data passed by the caller.
+	outFilename := path.Join(th.TempDir(), "out")
+	s, _ := th.ExecuteString("/t/main.tmpl", []string{dir + ":/t"}, []string{configFilename}, outFilename, DefaultOptions())
+	assert.Equal(t, "main=root git=git sh footer=root app", s)
+}
+
+func TestExecuteWithDirectoryConfigTags(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+	th := NewTestHarness(t, fs)
+	dir := th.TempDir()
+
+	// Write a secret key and an encrypted value.
+	keyFilename := path.Join(th.TempDir(), "secret.key")
+	key, err := GenerateSecretKey()
+	require.NoError(t, err)
+	th.WriteFileString(keyFilename, key)
+	secretKey, err := ReadSecretKey(fs, keyFilename)
+	require.NoError(t, err)
+	encrypted, err := EncryptSecret(secretKey, "s3cret")
+	require.NoError(t, err)
+
+	// Check that tags are resolved through the mounts and secrets are decrypted.
+	th.WriteFileString(path.Join(dir, "_config.yml"), "Config:\n  Version: !file VERSION\n  Token: "+encrypted)
+	th.WriteFileString(path.Join(dir, "VERSION"), "1.20")
+	th.WriteFileString(path.Join(dir, "a.tmpl"), "{{ .Version }} {{ .Token }}")
+
+	opts := DefaultOptions()
+	opts.SecretKeyFile = keyFilename
+	outFilename := path.Join(th.TempDir(), "out")
+	s, _ := th.ExecuteString("/target/a.tmpl", []string{dir + ":/target"}, nil, outFilename, opts)
+	assert.Equal(t, "1.20 s3cret", s)
+}
+
+func TestExecuteWhenDirectoryConfigInvalid(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+	th := NewTestHarness(t, fs)
+
+	tests := map[string]string{
+		"missing config": "User: root",
+		"duplicate key":  "Config:\n  User: root\n  User: app",
+		"not a mapping":  "Config: [root]",
+	}
+
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := th.TempDir()
+			th.WriteFileString(path.Join(dir, "_config.yml"), content)
+			th.WriteFileString(path.Join(dir, "a.tmpl"), "{{ .User }}")
+
+			outFilename := path.Join(th.TempDir(), "out")
+			_, err := Execute(fs, "/target/a.tmpl", []string{dir + ":/target"}, nil, outFilename, DefaultOptions())
+			require.ErrorIs(t, err, ErrConfigInvalid)
+			assert.Contains(t, err.Error(), "/target/_config.yml")
+		})
+	}
+}
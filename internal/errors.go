@@ -7,6 +7,40 @@ import (
 
 var ErrAbsolutePathRequired = fmt.Errorf("absolute path required")
 
+var ErrConfigCycle = errors.New("config cycle")
+
+var ErrConfigInterpolation = errors.New("invalid config reference")
+
 var ErrConfigInvalid = fmt.Errorf("invalid config")
 
+var ErrConfigTag = errors.New("invalid config tag")
+
+var ErrConfigStrict = errors.New("strict config")
+
+var ErrConfigMigration = errors.New("invalid config migration")
+
+var ErrConfigPatch = errors.New("invalid config patch")
+
+var ErrConfigProfileUnknown = errors.New("unknown config profile")
+
+var ErrFileRequired = errors.New("file required")
+
+var ErrLockInvalid = errors.New("invalid lockfile")
+
+var ErrLockKeyInvalid = errors.New("invalid lock key")
+
+var ErrLockMismatch = errors.New("lockfile mismatch")
+
+var ErrLockSignatureInvalid = errors.New("invalid lockfile signature")
+
 var ErrMountInvalid = errors.New("invalid mount")
+
+var ErrMountSkipped = errors.New("mount skipped")
+
+var ErrSecretInvalid = errors.New("invalid secret")
+
+var ErrSecretKeyInvalid = errors.New("invalid secret key")
+
+var ErrSecretKeyRequired = errors.New("secret key required")
+
+var ErrSymlinkRequired = errors.New("symlink required")
@@ -1,15 +1,28 @@
 package internal
 
 import (
+	"io"
 	"os"
 	"path"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/spf13/afero"
 )
 
 type Options struct {
-	MissingKey string
+	MissingKey       string
+	ConfigMigrations string
+	ConfigPatches    []string
+	ConfigTags       []string
+	Inline           []string
+	InlineFiles      []string
+	Lock             *Lock
+	Profiles         []string
+	SecretKeyFile    string
+	StrictConfig     bool
+	Stdin            io.Reader
 }
 
 func DefaultOptions() Options {
@@ -19,8 +32,11 @@ func DefaultOptions() Options {
 }
 
 type Result struct {
-	Filenames []string
-	Duration  time.Duration
+	Filenames    []string
+	Dependencies []string
+	GitRevisions []GitRevision
+	Warnings     []ConfigWarning
+	Duration     time.Duration
 }
 
 func Execute(fs afero.Fs, tmplFilename string, mountSpecs []string, configFilenames []string, outFilename string, opts Options) (*Result, error) {
@@ -33,8 +49,21 @@ func Execute(fs afero.Fs, tmplFilename string, mountSpecs []string, configFilena
 		return nil, err
 	}
 
+	// Add the inline files with the highest precedence.
+	inlineMounts, err := NewInlineMounts(fs, opts.Inline, opts.InlineFiles)
+	if err != nil {
+		return nil, err
+	}
+	mounts = append(inlineMounts, mounts...)
+
+	// Inline files are given on the command line and the built-in library is
+	// versioned with tmpl, so they are not locked.
+	if opts.Lock != nil {
+		opts.Lock = opts.Lock.unlock(inlineMounts).unlock(mounts.std())
+	}
+
 	// Create the config spec.
-	configSpec, err := NewConfigSpec(fs, configFilenames)
+	configSpec, err := NewConfigSpec(fs, mounts, configFilenames, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -50,35 +79,58 @@ func Execute(fs afero.Fs, tmplFilename string, mountSpecs []string, configFilena
 	}
 
 	// Execute the template.
-	err = execute(fs, tmplFilename, mounts, configSpec, outFilename, opts)
+	dependencies, err := execute(fs, tmplFilename, mounts, configSpec, outFilename, opts)
 	if err != nil {
-		return nil, err
+		return nil, configSpec.RedactError(err)
 	}
 
+	// Include the files read by config templates.
+	dependencies = append(dependencies, configSpec.dependencies...)
+	slices.Sort(dependencies)
+
 	// Return the result.
 	return &Result{
-		Filenames: []string{outFilename},
-		Duration:  time.Since(start),
+		Filenames:    []string{outFilename},
+		Dependencies: slices.Compact(dependencies),
+		GitRevisions: mounts.GitRevisions(),
+		Warnings:     configSpec.Warnings(),
+		Duration:     time.Since(start),
 	}, nil
 }
 
-func execute(fs afero.Fs, tmplFilename string, mounts Mounts, configSpec *ConfigSpec, outFilename string, opts Options) error {
+func execute(fs afero.Fs, tmplFilename string, mounts Mounts, configSpec *ConfigSpec, outFilename string, opts Options) ([]string, error) {
 	// Create the template cache.
 	templateManager := NewTemplateCache(mounts, opts)
+	templateManager.configSpec = configSpec
 
 	// Create the template.
 	t, err := templateManager.Template(tmplFilename)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Create the out file.
 	outFile, err := fs.Create(outFilename)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer outFile.Close()
 
 	// Execute the template.
-	return t.Execute(outFile, mounts, configSpec.config)
+	if err := t.Execute(outFile, mounts, configSpec.config); err != nil {
+		return nil, err
+	}
+
+	// Return the files read through the mounts.
+	return templateManager.Dependencies(), nil
+}
+
+func WriteDependencies(fs afero.Fs, name string, dependencies []string) error {
+	// Write one path per line so that other tools can read the file.
+	var b strings.Builder
+	for _, dependency := range dependencies {
+		b.WriteString(dependency + "\n")
+	}
+
+	return afero.WriteFile(fs, name, []byte(b.String()), 0644)
 }
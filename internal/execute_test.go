@@ -7,6 +7,7 @@ import (
 
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestExecute(t *testing.T) {
@@ -66,3 +67,37 @@ func TestExecuteWhenSimilarPaths(t *testing.T) {
 	assert.ElementsMatch(t, []string{outFilename}, result.Filenames)
 	assert.GreaterOrEqual(t, result.Duration, time.Duration(0))
 }
+
+func TestExecuteDependencies(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+	th := NewTestHarness(t, fs)
+	dir := th.TempDir()
+	th.WriteFileString(path.Join(dir, "a.tmpl"), `{{ include "b.tmpl" . }}{{ fileSha256 "c.txt" | trunc 8 }}`)
+	th.WriteFileString(path.Join(dir, "b.tmpl"), `{{ .Name }}`)
+	th.WriteFileString(path.Join(dir, "c.txt"), "c")
+	th.WriteFileString(path.Join(dir, "_config.yml"), "Config:\n  Name: b")
+	th.WriteFileString(path.Join(dir, "unused.tmpl"), "")
+	th.WriteFileString(path.Join(dir, "VERSION"), "1")
+
+	configFilename := path.Join(th.TempDir(), "config.tmpl.yml")
+	th.WriteFileString(configFilename, `Config:
+  Version: '{{ includeText "/target/VERSION" }}'`)
+
+	outFilename := path.Join(th.TempDir(), "out")
+	s, result := th.ExecuteString("/target/a.tmpl", []string{dir + ":/target"}, []string{configFilename}, outFilename, DefaultOptions())
+	assert.Equal(t, "b"+sha256Hex("c")[:8], s)
+	assert.Equal(t, []string{
+		"/target/VERSION",
+		"/target/_config.yml",
+		"/target/a.tmpl",
+		"/target/b.tmpl",
+		"/target/c.txt",
+	}, result.Dependencies)
+
+	// Check that the dependencies can be written to a file.
+	depsFilename := path.Join(th.TempDir(), "deps")
+	require.NoError(t, WriteDependencies(fs, depsFilename, result.Dependencies))
+	assert.Equal(t, "/target/VERSION\n/target/_config.yml\n/target/a.tmpl\n/target/b.tmpl\n/target/c.txt\n", th.ReadFileString(depsFilename))
+}
@@ -0,0 +1,53 @@
+package internal
+
+import (
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+type FileInfo struct {
+	Path    string
+	Base    string
+	Ext     string
+	Dir     string
+	Rel     string
+	Size    int64
+	Mode    os.FileMode
+	ModTime time.Time
+	IsDir   bool
+	Source  string
+}
+
+func newFileInfo(targetPath string, relDir string) *FileInfo {
+	// Describe the path relative to the given directory.
+	rel, ok := cutTargetPath(relDir, targetPath)
+	if !path.IsAbs(relDir) {
+		rel = targetPath
+	} else if !ok {
+		rel = relativePath(relDir, targetPath)
+	} else if rel == "" {
+		rel = "."
+	}
+
+	return &FileInfo{
+		Path: targetPath,
+		Base: path.Base(targetPath),
+		Ext:  path.Ext(targetPath),
+		Dir:  path.Dir(targetPath),
+		Rel:  rel,
+	}
+}
+
+func relativePath(dir string, p string) string {
+	// Go up from the directory until it contains the path.
+	var up []string
+	for {
+		if rel, ok := cutTargetPath(dir, p); ok {
+			return path.Join(strings.Join(up, "/"), rel)
+		}
+		dir = path.Dir(dir)
+		up = append(up, "..")
+	}
+}
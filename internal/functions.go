@@ -1,8 +1,15 @@
 package internal
 
 import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"os"
 	"path"
+	"slices"
 	"text/template"
 )
 
@@ -28,24 +35,35 @@ func NewFunctions(
 
 func (f *Functions) FuncMap() template.FuncMap {
 	return template.FuncMap{
-		"dirs":        f.dirsFunc,
-		"filename":    f.filenameFunc,
-		"files":       f.filesFunc,
-		"include":     f.includeFunc,
-		"includeText": f.includeTextFunc,
+		"dirs":          f.dirsFunc,
+		"exists":        f.existsFunc,
+		"fileInfo":      f.fileInfoFunc,
+		"filename":      f.filenameFunc,
+		"files":         f.filesFunc,
+		"glob":          f.globFunc,
+		"fileSha256":    f.fileSha256Func,
+		"fileSha512":    f.fileSha512Func,
+		"fileSize":      f.fileSizeFunc,
+		"include":       f.includeFunc,
+		"includeBase64": f.includeBase64Func,
+		"includeText":   f.includeTextFunc,
+		"profiles":      f.profilesFunc,
+		"readlink":      f.readlinkFunc,
+		"stat":          f.statFunc,
+		"treeHash":      f.treeHashFunc,
 	}
 }
 
-func (f *Functions) dirsFunc(pattern string) ([]string, error) {
-	return f.mounts.Directories(pattern)
+func (f *Functions) dirsFunc(patterns ...string) ([]string, error) {
+	return f.mounts.Directories(patterns...)
 }
 
 func (f *Functions) filenameFunc() string {
 	return f.filename
 }
 
-func (f *Functions) filesFunc(pattern string) ([]string, error) {
-	return f.mounts.Files(pattern)
+func (f *Functions) filesFunc(patterns ...string) ([]string, error) {
+	return f.mounts.Files(patterns...)
 }
 
 func (f *Functions) includeFunc(filename string, data any) (string, error) {
@@ -81,5 +99,166 @@ func (f *Functions) includeTextFunc(filename string) (string, error) {
 	}
 
 	// Read the file as a string.
-	return f.mounts.ReadFileString(filename)
+	b, err := f.readFile(filename)
+	return string(b), err
+}
+
+func (f *Functions) profilesFunc() []string {
+	return slices.Clone(f.cache.options.Profiles)
+}
+
+func (f *Functions) readlinkFunc(filename string) (string, error) {
+	// Read the target of the symlink.
+	return f.mounts.Readlink(f.resolvePath(filename))
+}
+
+func (f *Functions) existsFunc(filename string) (bool, error) {
+	// Check if a file or directory is mounted at the path.
+	_, err := f.mounts.Stat(f.resolvePath(filename))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (f *Functions) fileInfoFunc(filename string) *FileInfo {
+	// Describe the path without reading the mounts.
+	return newFileInfo(f.resolvePath(filename), path.Dir(f.filename))
+}
+
+func (f *Functions) globFunc(patterns ...string) ([]*FileInfo, error) {
+	files, err := f.mounts.Files(patterns...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Describe the files relative to the literal directory of the first pattern.
+	base := patternBase(patterns)
+	infos := make([]*FileInfo, 0, len(files))
+	for _, file := range files {
+		info, err := f.stat(file, base)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
+
+func (f *Functions) statFunc(filename string) (*FileInfo, error) {
+	return f.stat(f.resolvePath(filename), path.Dir(f.filename))
+}
+
+func (f *Functions) stat(filename string, relDir string) (*FileInfo, error) {
+	info, err := f.mounts.Stat(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	// Add the path fields.
+	pathInfo := newFileInfo(filename, relDir)
+	info.Base, info.Ext, info.Dir, info.Rel = pathInfo.Base, pathInfo.Ext, pathInfo.Dir, pathInfo.Rel
+	return info, nil
+}
+
+func (f *Functions) resolvePath(filename string) string {
+	// Check if the filename is a relative path.
+	if !path.IsAbs(filename) {
+		// Convert to an absolute path using the directory of
+		// the current filename as the root.
+		filename = path.Join(path.Dir(f.filename), filename)
+
+		// Clean to remove any ".." or ".".
+		filename = path.Clean(filename)
+	}
+
+	return filename
+}
+
+func (f *Functions) includeBase64Func(filename string) (string, error) {
+	b, err := f.readFile(f.resolvePath(filename))
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+func (f *Functions) fileSha256Func(filename string) (string, error) {
+	b, err := f.readFile(f.resolvePath(filename))
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (f *Functions) fileSha512Func(filename string) (string, error) {
+	b, err := f.readFile(f.resolvePath(filename))
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha512.Sum512(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (f *Functions) fileSizeFunc(filename string) (int64, error) {
+	filename = f.resolvePath(filename)
+	info, err := f.mounts.Stat(filename)
+	if err != nil {
+		return 0, err
+	}
+	if info.IsDir {
+		return 0, fmt.Errorf("%w: %s", ErrFileRequired, filename)
+	}
+
+	f.recordDependency(filename)
+	return info.Size, nil
+}
+
+func (f *Functions) treeHashFunc(patterns ...string) (string, error) {
+	files, err := f.mounts.Files(patterns...)
+	if err != nil {
+		return "", err
+	}
+
+	// Hash the files relative to the literal directory of the first pattern,
+	// so that the hash does not depend on where the files are mounted.
+	base := patternBase(patterns)
+
+	// Hash a sorted list of file hashes and paths, like 'sha256sum' output.
+	slices.Sort(files)
+	h := sha256.New()
+	for _, file := range files {
+		b, err := f.readFile(file)
+		if err != nil {
+			return "", err
+		}
+
+		sum := sha256.Sum256(b)
+		fmt.Fprintf(h, "%x  %s\n", sum, newFileInfo(file, base).Rel)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (f *Functions) readFile(filename string) ([]byte, error) {
+	// Read through the cache to check and record the file.
+	if f.cache == nil {
+		return f.mounts.ReadFile(filename)
+	}
+
+	return f.cache.readFile(filename)
+}
+
+func (f *Functions) recordDependency(filename string) {
+	if f.cache != nil {
+		f.cache.recordDependency(filename)
+	}
 }
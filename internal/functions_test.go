@@ -1,7 +1,10 @@
 package internal
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"os"
 	"path"
 	"testing"
 
@@ -86,6 +89,25 @@ func TestFilesFunc(t *testing.T) {
 		"/target/c/d",
 		"/target/c/e",
 	})
+
+	files, err = funcs.filesFunc("/target/**", "!/target/{a,c/d}")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, files, []string{
+		"/target/b",
+		"/target/c/e",
+		"/target/f",
+	})
+}
+
+func TestProfilesFunc(t *testing.T) {
+	t.Parallel()
+
+	opts := DefaultOptions()
+	opts.Profiles = []string{"prod", "eu"}
+	cache := NewTemplateCache(nil, opts)
+	funcs := NewFunctions("/target/filename", nil, cache)
+
+	assert.Equal(t, []string{"prod", "eu"}, funcs.profilesFunc())
 }
 
 func TestIncludeFunc(t *testing.T) {
@@ -190,3 +212,194 @@ func TestIncludeTextFunc(t *testing.T) {
 		})
 	}
 }
+
+func TestReadlinkFunc(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewOsFs()
+	th := NewTestHarness(t, fs)
+	dir := t.TempDir()
+
+	th.Mkdir(path.Join(dir, "v2"), 0755)
+	th.WriteFileString(path.Join(dir, "v2", "a"), "")
+	require.NoError(t, os.Symlink("v2", path.Join(dir, "current")))
+
+	filename := "/target/filename"
+	mounts := th.NewMounts(dir + ":/target")
+	cache := NewTemplateCache(mounts, DefaultOptions())
+	funcs := NewFunctions(filename, mounts, cache)
+
+	target, err := funcs.readlinkFunc("./current")
+	require.NoError(t, err)
+	assert.Equal(t, "v2", target)
+
+	_, err = funcs.readlinkFunc("/target/v2")
+	assert.ErrorIs(t, err, ErrSymlinkRequired)
+
+	_, err = funcs.readlinkFunc("/target/missing")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestStatFunc(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+	th := NewTestHarness(t, fs)
+	dir := th.TempDir()
+	th.WriteFileString(path.Join(dir, "docs", "guide.md"), "# Guide")
+
+	mounts := th.NewMounts(dir + ":/target")
+	cache := NewTemplateCache(mounts, DefaultOptions())
+	funcs := NewFunctions("/target/index.tmpl", mounts, cache)
+
+	info, err := funcs.statFunc("./docs/guide.md")
+	require.NoError(t, err)
+	assert.Equal(t, "/target/docs/guide.md", info.Path)
+	assert.Equal(t, "guide.md", info.Base)
+	assert.Equal(t, ".md", info.Ext)
+	assert.Equal(t, "/target/docs", info.Dir)
+	assert.Equal(t, "docs/guide.md", info.Rel)
+	assert.Equal(t, int64(7), info.Size)
+	assert.False(t, info.IsDir)
+	assert.Equal(t, path.Join(dir, "docs", "guide.md"), info.Source)
+
+	info, err = funcs.statFunc("/target/docs")
+	require.NoError(t, err)
+	assert.True(t, info.IsDir)
+
+	_, err = funcs.statFunc("/target/missing.md")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestExistsFunc(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+	th := NewTestHarness(t, fs)
+	dir := th.TempDir()
+	th.WriteFileString(path.Join(dir, "a"), "")
+
+	mounts := th.NewMounts(dir + ":/target")
+	cache := NewTemplateCache(mounts, DefaultOptions())
+	funcs := NewFunctions("/target/index.tmpl", mounts, cache)
+
+	for filename, expected := range map[string]bool{"a": true, "/target": true, "/target/b": false, "/other": false} {
+		exists, err := funcs.existsFunc(filename)
+		require.NoError(t, err)
+		assert.Equal(t, expected, exists, filename)
+	}
+}
+
+func TestFileInfoFunc(t *testing.T) {
+	t.Parallel()
+
+	funcs := NewFunctions("/target/modules/index.tmpl", nil, nil)
+	assert.Equal(t, &FileInfo{
+		Path: "/target/includes/en.tmpl",
+		Base: "en.tmpl",
+		Ext:  ".tmpl",
+		Dir:  "/target/includes",
+		Rel:  "../includes/en.tmpl",
+	}, funcs.fileInfoFunc("../includes/en.tmpl"))
+}
+
+func TestGlobFunc(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+	th := NewTestHarness(t, fs)
+	dir := th.TempDir()
+	th.WriteFileString(path.Join(dir, "docs", "a.md"), "a")
+	th.WriteFileString(path.Join(dir, "docs", "guide", "b.md"), "bb")
+	th.WriteFileString(path.Join(dir, "docs", "guide", "c.txt"), "")
+
+	mounts := th.NewMounts(dir + ":/target")
+	cache := NewTemplateCache(mounts, DefaultOptions())
+	funcs := NewFunctions("/target/index.tmpl", mounts, cache)
+
+	infos, err := funcs.globFunc("!/target/docs/a.md", "/target/docs/**/*.md")
+	require.NoError(t, err)
+	require.Len(t, infos, 1)
+	assert.Equal(t, "/target/docs/guide/b.md", infos[0].Path)
+	assert.Equal(t, "guide/b.md", infos[0].Rel)
+	assert.Equal(t, int64(2), infos[0].Size)
+
+	// Check that templates can use the fields.
+	th.WriteFileString(path.Join(dir, "index.tmpl"), `{{ range glob "/target/docs/**/*.md" }}{{ .Rel }}={{ .Size }} {{ end }}{{ if exists "missing.md" }}missing{{ end }}`)
+	outFilename := path.Join(th.TempDir(), "out")
+	s, _ := th.ExecuteString("/target/index.tmpl", []string{dir + ":/target"}, nil, outFilename, DefaultOptions())
+	assert.Equal(t, "a.md=1 guide/b.md=2 ", s)
+}
+
+func TestFileContentFuncs(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+	th := NewTestHarness(t, fs)
+	dir := th.TempDir()
+	th.WriteFileString(path.Join(dir, "logo.png"), "\x89PNG\x00")
+	th.WriteFileString(path.Join(dir, "VERSION"), "1.2.3\n")
+
+	mounts := th.NewMounts(dir + ":/target")
+	cache := NewTemplateCache(mounts, DefaultOptions())
+	funcs := NewFunctions("/target/index.tmpl", mounts, cache)
+
+	s, err := funcs.includeBase64Func("logo.png")
+	require.NoError(t, err)
+	assert.Equal(t, "iVBORwA=", s)
+
+	s, err = funcs.fileSha256Func("/target/VERSION")
+	require.NoError(t, err)
+	assert.Equal(t, sha256Hex("1.2.3\n"), s)
+
+	s, err = funcs.fileSha512Func("/target/VERSION")
+	require.NoError(t, err)
+	assert.Len(t, s, 128)
+
+	size, err := funcs.fileSizeFunc("VERSION")
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), size)
+
+	_, err = funcs.fileSizeFunc("/target")
+	assert.ErrorIs(t, err, ErrFileRequired)
+
+	_, err = funcs.fileSha256Func("missing")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// Check that the files were recorded as dependencies.
+	assert.Equal(t, []string{"/target/VERSION", "/target/logo.png"}, cache.Dependencies())
+}
+
+func TestTreeHashFunc(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+	th := NewTestHarness(t, fs)
+	dir := th.TempDir()
+	th.WriteFileString(path.Join(dir, "a.tmpl"), "a")
+	th.WriteFileString(path.Join(dir, "sub", "b.tmpl"), "b")
+	th.WriteFileString(path.Join(dir, "c.txt"), "c")
+
+	treeHash := func(target string, patterns ...string) string {
+		mounts := th.NewMounts(dir + ":" + target)
+		funcs := NewFunctions(target+"/index.tmpl", mounts, NewTemplateCache(mounts, DefaultOptions()))
+		s, err := funcs.treeHashFunc(patterns...)
+		require.NoError(t, err)
+		return s
+	}
+
+	// The hash is the hash of 'sha256sum' style lines.
+	expected := sha256Hex(sha256Hex("a") + "  a.tmpl\n" + sha256Hex("b") + "  sub/b.tmpl\n")
+	assert.Equal(t, expected, treeHash("/lib", "/lib/**/*.tmpl"))
+
+	// Check that the hash does not depend on the mount target.
+	assert.Equal(t, expected, treeHash("/other", "/other/**/*.tmpl"))
+
+	// Check that the hash changes with the files.
+	assert.NotEqual(t, expected, treeHash("/lib", "/lib/**", "!/lib/c.txt", "!/lib/sub/**"))
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,186 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+type GitRevision struct {
+	Repository string
+	Revision   string
+	Commit     string
+}
+
+func cutGitSource(source string) (string, string, string) {
+	// Split the path inside the tree and the revision from the repository.
+	source, member, _ := strings.Cut(source, "//")
+	i := strings.LastIndex(source, "@")
+	if i == -1 {
+		return source, "HEAD", member
+	}
+
+	return source[:i], source[i+1:], member
+}
+
+func newGitFs(repoPath string, revision string) (afero.Fs, string, error) {
+	// Resolve the revision to a commit.
+	out, err := git(repoPath, nil, "rev-parse", "--verify", "--end-of-options", revision+"^{commit}")
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %s@%s: %w", ErrMountInvalid, repoPath, revision, err)
+	}
+	commit := strings.TrimSpace(string(out))
+
+	// Read the tree of the commit into memory without a checkout.
+	gitFs := afero.NewMemMapFs()
+	if err := readGitTree(gitFs, repoPath, commit); err != nil {
+		return nil, "", fmt.Errorf("%w: %s@%s: %w", ErrMountInvalid, repoPath, commit, err)
+	}
+
+	return afero.NewReadOnlyFs(gitFs), commit, nil
+}
+
+type gitTreeEntry struct {
+	mode   string
+	object string
+	path   string
+}
+
+func readGitTree(fs afero.Fs, repoPath string, commit string) error {
+	// List the files of the tree as they are stored, unlike 'git archive',
+	// which applies the export attributes.
+	out, err := git(repoPath, nil, "ls-tree", "-r", "-z", "--full-tree", commit)
+	if err != nil {
+		return err
+	}
+
+	var entries []gitTreeEntry
+	for _, line := range strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00") {
+		if line == "" {
+			continue
+		}
+
+		// Each entry is '<mode> <type> <object>\t<path>'.
+		info, p, _ := strings.Cut(line, "\t")
+		fields := strings.Fields(info)
+		if len(fields) != 3 {
+			return fmt.Errorf("unexpected git ls-tree output: %s", line)
+		}
+
+		// Skip submodules, which are commits of other repositories.
+		if fields[1] == "blob" {
+			entries = append(entries, gitTreeEntry{mode: fields[0], object: fields[2], path: archiveMemberPath(p)})
+		}
+	}
+
+	// Read the contents of the blobs in one batch.
+	var objects bytes.Buffer
+	for _, entry := range entries {
+		objects.WriteString(entry.object + "\n")
+	}
+	out, err = git(repoPath, &objects, "cat-file", "--batch")
+	if err != nil {
+		return err
+	}
+
+	blobs := map[string][]byte{}
+	r := bufio.NewReader(bytes.NewReader(out))
+	for range entries {
+		// Each blob is '<object> <type> <size>\n<contents>\n'.
+		header, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		fields := strings.Fields(header)
+		if len(fields) != 3 {
+			return fmt.Errorf("unexpected git cat-file output: %s", strings.TrimSpace(header))
+		}
+		size, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return err
+		}
+
+		b := make([]byte, size+1)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return err
+		}
+		blobs[fields[0]] = b[:size]
+	}
+
+	// Write the files, and the symlinks that point to files in the tree as
+	// copies of those files.
+	files := map[string]gitTreeEntry{}
+	for _, entry := range entries {
+		files[entry.path] = entry
+	}
+	if err := fs.MkdirAll("/", 0755); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		target, ok := resolveGitSymlink(files, blobs, entry)
+		if !ok {
+			continue
+		}
+
+		mode := os.FileMode(0644)
+		if target.mode == "100755" {
+			mode = 0755
+		}
+		if err := fs.MkdirAll(path.Dir(entry.path), 0755); err != nil {
+			return err
+		}
+		if err := afero.WriteFile(fs, entry.path, blobs[target.object], mode); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func resolveGitSymlink(files map[string]gitTreeEntry, blobs map[string][]byte, entry gitTreeEntry) (gitTreeEntry, bool) {
+	// Follow symlinks to the file they point to in the tree. Symlinks to
+	// directories, outside the tree or that are broken are skipped.
+	for range 40 {
+		if entry.mode != "120000" {
+			return entry, true
+		}
+
+		target := path.Join(strings.TrimPrefix(path.Dir(entry.path), "/"), string(blobs[entry.object]))
+		if path.IsAbs(string(blobs[entry.object])) || target == ".." || strings.HasPrefix(target, "../") {
+			return entry, false
+		}
+
+		var ok bool
+		entry, ok = files["/"+target]
+		if !ok {
+			return entry, false
+		}
+	}
+
+	return entry, false
+}
+
+func git(repoPath string, stdin io.Reader, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", append([]string{"-C", repoPath}, args...)...)
+	cmd.Stdin = stdin
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return nil, fmt.Errorf("git %s: %w", args[0], err)
+	}
+
+	return out, nil
+}
@@ -0,0 +1,160 @@
+package internal
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestGitRunner(t *testing.T, dir string) func(args ...string) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	return func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com", "-c", "commit.gpgsign=false", "-c", "tag.gpgsign=false"}, args...)...)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+		return strings.TrimSpace(string(out))
+	}
+}
+
+func newTestGitRepo(t *testing.T) (string, string) {
+	dir := t.TempDir()
+	run := newTestGitRunner(t, dir)
+
+	// Commit and tag the first version.
+	run("init", "-q")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "lib", "b"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "lib", "a.tmpl"), []byte("v1"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "lib", "b", "c.tmpl"), []byte("c"), 0644))
+	run("add", ".")
+	run("commit", "-q", "-m", "v1")
+	run("tag", "v1.0.0")
+	commit := run("rev-parse", "HEAD")
+
+	// Change the working tree and commit the second version.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "lib", "a.tmpl"), []byte("v2"), 0644))
+	run("commit", "-q", "-am", "v2")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "lib", "a.tmpl"), []byte("uncommitted"), 0644))
+
+	return dir, commit
+}
+
+func TestMountWhenGitRevision(t *testing.T) {
+	t.Parallel()
+
+	repo, commit := newTestGitRepo(t)
+	th := NewTestHarness(t, afero.NewOsFs())
+
+	// Mount the tagged revision.
+	m := th.NewMount("git:" + repo + "@v1.0.0:/repo")
+	s, err := m.ReadFileString("/repo/lib/a.tmpl")
+	require.NoError(t, err)
+	assert.Equal(t, "v1", s)
+	assert.Equal(t, &GitRevision{Repository: repo, Revision: "v1.0.0", Commit: commit}, m.revision)
+
+	// Mount a directory of the latest commit.
+	m = th.NewMount("git:" + repo + "//lib:/lib")
+	s, err = m.ReadFileString("/lib/a.tmpl")
+	require.NoError(t, err)
+	assert.Equal(t, "v2", s)
+	var files []string
+	require.NoError(t, m.Files("/lib/*/*", &files, nil))
+	assert.Equal(t, []string{"/lib/b/c.tmpl"}, files)
+}
+
+func TestMountWhenGitRevisionHasAttributesAndSymlinks(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	run := newTestGitRunner(t, dir)
+	outside := t.TempDir()
+
+	// Commit files with export attributes, an executable file and symlinks.
+	run("init", "-q")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "lib", "b"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".gitattributes"), []byte("ignored.tmpl export-ignore\nsubst.tmpl export-subst\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ignored.tmpl"), []byte("ignored"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "subst.tmpl"), []byte("$Format:%H$"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "run.sh"), []byte("#!/bin/sh"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "lib", "b", "c.tmpl"), []byte("c"), 0644))
+	require.NoError(t, os.Symlink("b/c.tmpl", filepath.Join(dir, "lib", "file-link")))
+	require.NoError(t, os.Symlink("file-link", filepath.Join(dir, "lib", "chain-link")))
+	require.NoError(t, os.Symlink("b", filepath.Join(dir, "lib", "dir-link")))
+	require.NoError(t, os.Symlink("missing", filepath.Join(dir, "lib", "broken-link")))
+	require.NoError(t, os.Symlink("../../outside", filepath.Join(dir, "lib", "escaping-link")))
+	require.NoError(t, os.Symlink(filepath.Join(outside, "secret"), filepath.Join(dir, "absolute-link")))
+	require.NoError(t, os.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0644))
+	run("add", ".")
+	run("commit", "-q", "-m", "v1")
+
+	th := NewTestHarness(t, afero.NewOsFs())
+	m := th.NewMount("git:" + dir + ":/repo")
+
+	// Check that the files are mounted as they are stored in the commit.
+	for p, expected := range map[string]string{
+		"/repo/ignored.tmpl":   "ignored",
+		"/repo/subst.tmpl":     "$Format:%H$",
+		"/repo/lib/file-link":  "c",
+		"/repo/lib/chain-link": "c",
+		"/repo/lib/b/c.tmpl":   "c",
+		"/repo/run.sh":         "#!/bin/sh",
+		"/repo/.gitattributes": "ignored.tmpl export-ignore\nsubst.tmpl export-subst\n",
+	} {
+		s, err := m.ReadFileString(p)
+		require.NoError(t, err, p)
+		assert.Equal(t, expected, s, p)
+	}
+
+	info, err := m.Stat("/repo/run.sh")
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode.Perm())
+
+	// Check that symlinks to directories, outside the tree or that are broken
+	// are skipped.
+	var files []string
+	require.NoError(t, m.Files("/repo/**", &files, nil))
+	assert.ElementsMatch(t, []string{
+		"/repo/.gitattributes",
+		"/repo/ignored.tmpl",
+		"/repo/run.sh",
+		"/repo/subst.tmpl",
+		"/repo/lib/chain-link",
+		"/repo/lib/file-link",
+		"/repo/lib/b/c.tmpl",
+	}, files)
+}
+
+func TestMountWhenGitRevisionInvalid(t *testing.T) {
+	t.Parallel()
+
+	repo, commit := newTestGitRepo(t)
+	th := NewTestHarness(t, afero.NewOsFs())
+
+	err := th.NewMountExpectingError("git:" + repo + "@v9.9.9:/repo")
+	assert.ErrorIs(t, err, ErrMountInvalid)
+	assert.ErrorContains(t, err, repo+"@v9.9.9: git rev-parse")
+
+	err = th.NewMountExpectingError("git:" + repo + "@v1.0.0//missing:/repo")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.EqualError(t, err, "file does not exist: "+repo+"@"+commit+"!missing")
+}
+
+func TestExecuteWhenGitRevision(t *testing.T) {
+	t.Parallel()
+
+	repo, commit := newTestGitRepo(t)
+	th := NewTestHarness(t, afero.NewOsFs())
+
+	outFilename := filepath.Join(t.TempDir(), "out")
+	s, result := th.ExecuteString("/lib/a.tmpl", []string{"git:" + repo + "@v1.0.0//lib:/lib"}, nil, outFilename, DefaultOptions())
+	assert.Equal(t, "v1", s)
+	assert.Equal(t, []GitRevision{{Repository: repo, Revision: "v1.0.0", Commit: commit}}, result.GitRevisions)
+}
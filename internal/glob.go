@@ -0,0 +1,66 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+type Glob struct {
+	includes []string
+	excludes []string
+}
+
+func NewGlob(patterns ...string) (*Glob, error) {
+	// Patterns starting with '!' exclude the paths matched by other patterns.
+	g := &Glob{}
+	for _, pattern := range patterns {
+		p, negate := strings.CutPrefix(pattern, "!")
+		if !doublestar.ValidatePattern(p) {
+			return nil, fmt.Errorf("%w: %s", doublestar.ErrBadPattern, pattern)
+		}
+
+		if negate {
+			g.excludes = append(g.excludes, p)
+		} else {
+			g.includes = append(g.includes, p)
+		}
+	}
+
+	// Check that something can match.
+	if len(g.includes) == 0 {
+		return nil, fmt.Errorf("%w: at least one pattern without '!' is required", doublestar.ErrBadPattern)
+	}
+
+	return g, nil
+}
+
+func (g *Glob) Match(p string) bool {
+	// Check the excluded paths first.
+	for _, pattern := range g.excludes {
+		if doublestar.MatchUnvalidated(pattern, p) {
+			return false
+		}
+	}
+
+	for _, pattern := range g.includes {
+		if doublestar.MatchUnvalidated(pattern, p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func patternBase(patterns []string) string {
+	// Return the literal directory of the first pattern without '!'.
+	for _, pattern := range patterns {
+		if !strings.HasPrefix(pattern, "!") {
+			base, _ := doublestar.SplitPattern(pattern)
+			return base
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,61 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGlob(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		patterns []string
+		path     string
+		expected bool
+	}{
+		{[]string{"/modules/*"}, "/modules/a", true},
+		{[]string{"/modules/*"}, "/modules/core/a", false},
+		{[]string{"/modules/**/module.tmpl"}, "/modules/module.tmpl", true},
+		{[]string{"/modules/**/module.tmpl"}, "/modules/core/git/module.tmpl", true},
+		{[]string{"/config/*.{yml,yaml}"}, "/config/a.yaml", true},
+		{[]string{"/config/*.{yml,yaml}"}, "/config/a.json", false},
+		{[]string{"/includes/*", "!/includes/fr.tmpl"}, "/includes/en.tmpl", true},
+		{[]string{"/includes/*", "!/includes/fr.tmpl"}, "/includes/fr.tmpl", false},
+		{[]string{"/a/*", "/b/*"}, "/b/c", true},
+	}
+
+	for _, test := range tests {
+		glob, err := NewGlob(test.patterns...)
+		require.NoError(t, err)
+		assert.Equal(t, test.expected, glob.Match(test.path), "%v %s", test.patterns, test.path)
+	}
+}
+
+func TestGlobWhenInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, patterns := range [][]string{{"/a/["}, {"!/a/*"}, {}} {
+		_, err := NewGlob(patterns...)
+		assert.ErrorIs(t, err, doublestar.ErrBadPattern)
+	}
+}
+
+func TestPatternBase(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		patterns []string
+		expected string
+	}{
+		{[]string{"/docs/**/*.md"}, "/docs"},
+		{[]string{"!/docs/drafts/**", "/docs/*/*.md", "/other/*"}, "/docs"},
+		{[]string{"/config.yml"}, "/"},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, patternBase(test.patterns), "%v", test.patterns)
+	}
+}
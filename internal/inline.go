@@ -0,0 +1,64 @@
+package internal
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+func NewInlineMounts(fs afero.Fs, inline []string, inlineFiles []string) (Mounts, error) {
+	var mounts Mounts
+
+	// Write the inline content to files in memory.
+	inlineFs := afero.NewMemMapFs()
+	for _, spec := range inline {
+		targetPath, content, err := cutInlineSpec(spec, "/path=content")
+		if err != nil {
+			return nil, err
+		}
+
+		if err := afero.WriteFile(inlineFs, targetPath, []byte(content), 0644); err != nil {
+			return nil, err
+		}
+
+		mount, err := newSourceMount(inlineFs, "", targetPath, targetPath, newMountOptions())
+		if err != nil {
+			return nil, err
+		}
+		mounts = append(mounts, mount)
+	}
+
+	// Mount the host files at their paths. The paths are not parsed as mount
+	// specs, so they can contain ':' and end with archive extensions.
+	for _, spec := range inlineFiles {
+		targetPath, sourcePath, err := cutInlineSpec(spec, "/path=file")
+		if err != nil {
+			return nil, err
+		}
+
+		mount, err := newSourceMount(fs, "", sourcePath, targetPath, newMountOptions())
+		if err != nil {
+			return nil, err
+		}
+		mounts = append(mounts, mount)
+	}
+
+	return mounts, nil
+}
+
+func cutInlineSpec(spec string, format string) (string, string, error) {
+	// Check the format.
+	targetPath, value, ok := strings.Cut(spec, "=")
+	if !ok || targetPath == "" {
+		return "", "", fmt.Errorf("%w: format must be '%s'", ErrMountInvalid, format)
+	}
+
+	// Check that the target path is valid.
+	if !path.IsAbs(targetPath) {
+		return "", "", fmt.Errorf("%w: inline path: %s", ErrAbsolutePathRequired, targetPath)
+	}
+
+	return path.Clean(targetPath), value, nil
+}
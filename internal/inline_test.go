@@ -0,0 +1,78 @@
+package internal
+
+import (
+	"path"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteWithInlineFiles(t *testing.T) {
+	t.Parallel()
+
+	th := NewTestHarness(t, afero.NewMemMapFs())
+	dir := th.TempDir()
+	th.WriteFileString(path.Join(dir, "includes", "a.tmpl"), "mounted a")
+	th.WriteFileString(path.Join(dir, "includes", "b.tmpl"), "mounted b")
+	hostFile := path.Join(th.TempDir(), "c.tmpl")
+	th.WriteFileString(hostFile, "host {{ .Name }}")
+
+	opts := DefaultOptions()
+	opts.Inline = []string{
+		`/main.tmpl={{ range files "/includes/*" }}{{ include . $ }}, {{ end }}`,
+		"/includes/a.tmpl=inline a, with a comma",
+		"/includes/.wh.b.tmpl=",
+	}
+	opts.InlineFiles = []string{"/includes/c.tmpl=" + hostFile}
+
+	configFilename := path.Join(th.TempDir(), "config.yml")
+	th.WriteFileString(configFilename, "Config:\n  Name: c")
+
+	outFilename := path.Join(th.TempDir(), "out")
+	s, _ := th.ExecuteString("/main.tmpl", []string{dir + "/includes:/includes"}, []string{configFilename}, outFilename, opts)
+	assert.Equal(t, "inline a, with a comma, host c, ", s)
+}
+
+func TestNewInlineMountsWithSpecCharacters(t *testing.T) {
+	t.Parallel()
+
+	th := NewTestHarness(t, afero.NewMemMapFs())
+	hostFile := path.Join(th.TempDir(), "a:b.zip")
+	th.WriteFileString(hostFile, "host")
+
+	// Check that the paths are not parsed as mount specs or archives.
+	mounts, err := NewInlineMounts(th.fs, []string{
+		"/files/data.tar=hello",
+		"/files/x.zip=hi",
+		"/files/a:b.txt=colon",
+	}, []string{"/files/c:d.tar.gz=" + hostFile})
+	require.NoError(t, err)
+
+	for p, expected := range map[string]string{
+		"/files/data.tar":   "hello",
+		"/files/x.zip":      "hi",
+		"/files/a:b.txt":    "colon",
+		"/files/c:d.tar.gz": "host",
+	} {
+		s, err := mounts.ReadFileString(p)
+		require.NoError(t, err, p)
+		assert.Equal(t, expected, s)
+	}
+}
+
+func TestNewInlineMountsWhenInvalid(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+
+	_, err := NewInlineMounts(fs, []string{"content"}, nil)
+	assert.ErrorIs(t, err, ErrMountInvalid)
+
+	_, err = NewInlineMounts(fs, []string{"relative=content"}, nil)
+	assert.ErrorIs(t, err, ErrAbsolutePathRequired)
+
+	_, err = NewInlineMounts(fs, nil, []string{"/a=/missing"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,184 @@
+package internal
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type interpolator struct {
+	root     map[string]any
+	resolved map[string]any
+	stack    []string
+}
+
+func interpolate(config map[string]any) (map[string]any, error) {
+	ip := &interpolator{
+		root:     config,
+		resolved: make(map[string]any),
+	}
+
+	v, err := ip.value("", config)
+	if err != nil {
+		return nil, err
+	}
+
+	return v.(map[string]any), nil
+}
+
+func (ip *interpolator) value(keyPath string, v any) (any, error) {
+	switch t := v.(type) {
+	case map[string]any:
+		// Resolve the keys in order so that errors are predictable.
+		out := make(map[string]any, len(t))
+		for _, k := range sortedKeys(t) {
+			resolved, err := ip.value(joinKeyPath(keyPath, k), t[k])
+			if err != nil {
+				return nil, err
+			}
+			out[k] = resolved
+		}
+		return out, nil
+	case []any:
+		out := make([]any, len(t))
+		for i, child := range t {
+			resolved, err := ip.value(joinKeyPath(keyPath, strconv.Itoa(i)), child)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = resolved
+		}
+		return out, nil
+	case string:
+		return ip.string(keyPath, t)
+	default:
+		return v, nil
+	}
+}
+
+func (ip *interpolator) string(keyPath string, s string) (any, error) {
+	// Skip strings without references.
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+
+	// Reuse values that were already resolved.
+	if v, ok := ip.resolved[keyPath]; ok {
+		return v, nil
+	}
+
+	// Check for a cycle before resolving the references.
+	if slices.Contains(ip.stack, keyPath) {
+		chain := append(slices.Clone(ip.stack), keyPath)
+		return nil, fmt.Errorf("%w: %s", ErrConfigCycle, strings.Join(chain, " -> "))
+	}
+
+	ip.stack = append(ip.stack, keyPath)
+	defer func() {
+		ip.stack = ip.stack[:len(ip.stack)-1]
+	}()
+
+	// A string that is exactly one reference keeps the type of the referenced
+	// value. Otherwise, the referenced values are formatted into the string.
+	var v any
+	if ref, ok := singleReference(s); ok {
+		resolved, found, err := ip.reference(ref)
+		if err != nil {
+			return nil, err
+		} else if !found {
+			// Leave references to other variables, e.g. '${HOME}', unchanged.
+			resolved = s
+		}
+		v = resolved
+	} else {
+		resolved, err := ip.expand(keyPath, s)
+		if err != nil {
+			return nil, err
+		}
+		v = resolved
+	}
+
+	// Remember the value for other references.
+	ip.resolved[keyPath] = v
+	return v, nil
+}
+
+func (ip *interpolator) expand(keyPath string, s string) (string, error) {
+	var sb strings.Builder
+	for {
+		// Find the next reference or escaped reference.
+		i := strings.Index(s, "${")
+		if i < 0 {
+			sb.WriteString(s)
+			return sb.String(), nil
+		}
+
+		// An escaped reference is written without the escape character.
+		if i > 0 && s[i-1] == '$' {
+			sb.WriteString(s[:i-1])
+			sb.WriteString("${")
+			s = s[i+2:]
+			continue
+		}
+
+		// Keep the rest of the string when the reference does not end.
+		end := strings.Index(s[i:], "}")
+		if end < 0 {
+			sb.WriteString(s)
+			return sb.String(), nil
+		}
+
+		// Resolve the reference. References to other variables, e.g.
+		// '${HOME}', are written unchanged.
+		ref := strings.TrimSpace(s[i+2 : i+end])
+		v, found, err := ip.reference(ref)
+		if err != nil {
+			return "", err
+		} else if !found {
+			sb.WriteString(s[:i+end+1])
+			s = s[i+end+1:]
+			continue
+		}
+
+		// Only scalar values can be formatted into a string.
+		switch v.(type) {
+		case map[string]any, []any:
+			return "", fmt.Errorf("%w: %s: '%s' is not a scalar value", ErrConfigInterpolation, keyPath, ref)
+		}
+
+		sb.WriteString(s[:i])
+		if v != nil {
+			sb.WriteString(fmt.Sprint(v))
+		}
+		s = s[i+end+1:]
+	}
+}
+
+func (ip *interpolator) reference(ref string) (any, bool, error) {
+	// Check that the reference names a config key.
+	if ref == "" {
+		return nil, false, nil
+	}
+
+	v, ok := lookupKeyPath(ip.root, splitKeyPath(ref))
+	if !ok {
+		return nil, false, nil
+	}
+
+	resolved, err := ip.value(ref, v)
+	return resolved, true, err
+}
+
+func singleReference(s string) (string, bool) {
+	if !strings.HasPrefix(s, "${") || !strings.HasSuffix(s, "}") {
+		return "", false
+	}
+
+	ref := s[2 : len(s)-1]
+	if strings.Contains(ref, "${") || strings.Contains(ref, "}") {
+		return "", false
+	}
+
+	return strings.TrimSpace(ref), true
+}
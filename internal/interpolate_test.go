@@ -0,0 +1,113 @@
+package internal
+
+import (
+	"path"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInterpolate(t *testing.T) {
+	t.Parallel()
+
+	config, err := interpolate(map[string]any{
+		"Registry": "ghcr.io/${Owner}",
+		"Owner":    "jeremybower",
+		"Version":  "1.2.3",
+		"Image":    "${Registry}/app:${Version}",
+		"Port":     8080,
+		"Ports":    []any{"${Port}", "${ Port }0"},
+		"Escaped":  "$${Registry}",
+		"Go": map[string]any{
+			"Version": "1.22.5",
+			"Image":   "golang:${Go.Version}",
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{
+		"Registry": "ghcr.io/jeremybower",
+		"Owner":    "jeremybower",
+		"Version":  "1.2.3",
+		"Image":    "ghcr.io/jeremybower/app:1.2.3",
+		"Port":     8080,
+		"Ports":    []any{8080, "80800"},
+		"Escaped":  "${Registry}",
+		"Go": map[string]any{
+			"Version": "1.22.5",
+			"Image":   "golang:1.22.5",
+		},
+	}, config)
+}
+
+func TestInterpolateWhenCycle(t *testing.T) {
+	t.Parallel()
+
+	_, err := interpolate(map[string]any{
+		"A": "${B}",
+		"B": "x-${C}",
+		"C": "${A}",
+	})
+	require.ErrorIs(t, err, ErrConfigCycle)
+	assert.Contains(t, err.Error(), "A -> B -> C -> A")
+}
+
+func TestInterpolateWhenInvalid(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"not scalar": "x-${Map}",
+	}
+
+	for name, value := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := interpolate(map[string]any{
+				"A":     "a",
+				"Map":   map[string]any{"B": "b"},
+				"Value": value,
+			})
+			require.ErrorIs(t, err, ErrConfigInterpolation)
+			assert.Contains(t, err.Error(), "Value")
+		})
+	}
+}
+
+func TestInterpolateKeepsOtherVariables(t *testing.T) {
+	t.Parallel()
+
+	config, err := interpolate(map[string]any{
+		"A":       "a",
+		"Home":    "${HOME}",
+		"Command": "cd ${HOME} && echo ${A} ${BUILD_ARG:-x}",
+		"Empty":   "${}",
+		"Open":    "x-${A",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{
+		"A":       "a",
+		"Home":    "${HOME}",
+		"Command": "cd ${HOME} && echo a ${BUILD_ARG:-x}",
+		"Empty":   "${}",
+		"Open":    "x-${A",
+	}, config)
+}
+
+func TestNewConfigSpecInterpolatesAfterMerging(t *testing.T) {
+	t.Parallel()
+
+	th := NewTestHarness(t, afero.NewMemMapFs())
+	dir := th.TempDir()
+
+	config1 := path.Join(dir, "config1.yaml")
+	th.WriteFileString(config1, `Config:
+  Registry: docker.io
+  Image: "${Registry}/app"`)
+
+	config2 := path.Join(dir, "config2.yaml")
+	th.WriteFileString(config2, `Config:
+  Registry: ghcr.io`)
+
+	spec := th.NewConfigSpec(config1, config2)
+	assert.Equal(t, "ghcr.io/app", spec.config["Image"])
+}
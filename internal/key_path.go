@@ -0,0 +1,69 @@
+package internal
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+func splitKeyPath(keyPath string) []string {
+	return strings.Split(keyPath, ".")
+}
+
+func joinKeyPath(parent, key string) string {
+	if parent == "" {
+		return key
+	}
+
+	return parent + "." + key
+}
+
+func lookupKeyPath(v any, keys []string) (any, bool) {
+	for _, key := range keys {
+		switch t := v.(type) {
+		case map[string]any:
+			child, ok := t[key]
+			if !ok {
+				return nil, false
+			}
+			v = child
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(t) {
+				return nil, false
+			}
+			v = t[i]
+		default:
+			return nil, false
+		}
+	}
+
+	return v, true
+}
+
+func setKeyPath(m map[string]any, keys []string, v any) map[string]any {
+	// Copy the map so that shared maps are not modified.
+	out := make(map[string]any, len(m)+1)
+	for k, child := range m {
+		out[k] = child
+	}
+
+	// Set the value or replace the child map with a modified copy.
+	if len(keys) == 1 {
+		out[keys[0]] = v
+	} else {
+		child, _ := out[keys[0]].(map[string]any)
+		out[keys[0]] = setKeyPath(child, keys[1:], v)
+	}
+
+	return out
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,51 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLookupKeyPath(t *testing.T) {
+	t.Parallel()
+
+	m := map[string]any{
+		"A": map[string]any{
+			"B": []any{"c", "d"},
+		},
+	}
+
+	v, ok := lookupKeyPath(m, splitKeyPath("A.B.1"))
+	assert.True(t, ok)
+	assert.Equal(t, "d", v)
+
+	for _, keyPath := range []string{"Z", "A.Z", "A.B.2", "A.B.x", "A.B.0.Z"} {
+		_, ok = lookupKeyPath(m, splitKeyPath(keyPath))
+		assert.False(t, ok, keyPath)
+	}
+}
+
+func TestSetKeyPath(t *testing.T) {
+	t.Parallel()
+
+	m := map[string]any{
+		"A": map[string]any{
+			"B": "b",
+		},
+	}
+
+	out := setKeyPath(m, splitKeyPath("A.C.D"), "d")
+	assert.Equal(t, map[string]any{
+		"A": map[string]any{
+			"B": "b",
+			"C": map[string]any{"D": "d"},
+		},
+	}, out)
+
+	// The original map is unchanged.
+	assert.Equal(t, map[string]any{
+		"A": map[string]any{
+			"B": "b",
+		},
+	}, m)
+}
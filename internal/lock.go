@@ -0,0 +1,213 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+const lockSignatureExt = ".sig"
+
+type Lock struct {
+	hashes   map[string]string
+	unlocked Mounts
+}
+
+func NewLock(mounts Mounts) (*Lock, error) {
+	glob, err := NewGlob("/**")
+	if err != nil {
+		return nil, err
+	}
+
+	// List the files of every mount, including the files that a higher mount
+	// hides from listings but that can still be read.
+	var files []string
+	for _, mount := range mounts {
+		// Skip the built-in library since it is versioned with tmpl.
+		if mount.std {
+			continue
+		}
+
+		if err := mount.files(glob, &files, nil); err != nil {
+			return nil, err
+		}
+	}
+	slices.Sort(files)
+	files = slices.Compact(files)
+
+	// Hash the files that are read through the mounts.
+	lock := &Lock{hashes: map[string]string{}}
+	for _, file := range files {
+		b, err := mounts.ReadFile(file)
+		if errors.Is(err, os.ErrNotExist) {
+			// Skip the files hidden by whiteouts.
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		sum := sha256.Sum256(b)
+		lock.hashes[file] = hex.EncodeToString(sum[:])
+	}
+
+	return lock, nil
+}
+
+func (l *Lock) Bytes() []byte {
+	// Write the hashes in the same format as 'sha256sum'.
+	var b bytes.Buffer
+	for _, name := range sortedKeys(l.hashes) {
+		fmt.Fprintf(&b, "%s  %s\n", l.hashes[name], name)
+	}
+
+	return b.Bytes()
+}
+
+func WriteLock(fs afero.Fs, name string, lock *Lock, privateKeyFile string) error {
+	b := lock.Bytes()
+	if err := afero.WriteFile(fs, name, b, 0644); err != nil {
+		return err
+	}
+
+	// Sign the lockfile with the private key, if any.
+	if privateKeyFile == "" {
+		return nil
+	}
+
+	key, err := readLockPrivateKey(fs, privateKeyFile)
+	if err != nil {
+		return err
+	}
+
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(key, b))
+	return afero.WriteFile(fs, name+lockSignatureExt, []byte(sig+"\n"), 0644)
+}
+
+func LoadLock(fs afero.Fs, name string, publicKeyFile string) (*Lock, error) {
+	b, err := afero.ReadFile(fs, name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify the signature with the public key, if any.
+	if publicKeyFile != "" {
+		key, err := readLockPublicKey(fs, publicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		s, err := afero.ReadFile(fs, name+lockSignatureExt)
+		if err != nil {
+			return nil, err
+		}
+
+		sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(s)))
+		if err != nil || !ed25519.Verify(key, b, sig) {
+			return nil, fmt.Errorf("%w: %s", ErrLockSignatureInvalid, name+lockSignatureExt)
+		}
+	}
+
+	// Parse the hashes.
+	lock := &Lock{hashes: map[string]string{}}
+	for i, line := range strings.Split(string(b), "\n") {
+		if line == "" {
+			continue
+		}
+
+		hash, filename, ok := strings.Cut(line, "  ")
+		sum, err := hex.DecodeString(hash)
+		if !ok || err != nil || len(sum) != sha256.Size || !path.IsAbs(filename) {
+			return nil, fmt.Errorf("%w: %s:%d: expected 'sha256  /path'", ErrLockInvalid, name, i+1)
+		}
+		lock.hashes[filename] = hex.EncodeToString(sum)
+	}
+
+	return lock, nil
+}
+
+func (l *Lock) unlock(mounts Mounts) *Lock {
+	// Copy the lock so that the files of the mounts are not checked.
+	return &Lock{hashes: l.hashes, unlocked: slices.Concat(l.unlocked, mounts)}
+}
+
+func (l *Lock) verify(name string, b []byte) error {
+	// Files are only checked with a lockfile.
+	if l == nil {
+		return nil
+	}
+
+	// Skip the files that are read from the unlocked mounts.
+	for _, mount := range l.unlocked {
+		if unlocked, err := mount.ReadFile(name); err == nil && bytes.Equal(unlocked, b) {
+			return nil
+		}
+	}
+
+	hash, ok := l.hashes[name]
+	if !ok {
+		return fmt.Errorf("%w: file not locked: %s", ErrLockMismatch, name)
+	}
+
+	sum := sha256.Sum256(b)
+	if hex.EncodeToString(sum[:]) != hash {
+		return fmt.Errorf("%w: file changed: %s", ErrLockMismatch, name)
+	}
+
+	return nil
+}
+
+func readLockPrivateKey(fs afero.Fs, name string) (ed25519.PrivateKey, error) {
+	der, err := readPEMFile(fs, name)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if err != nil || !ok {
+		return nil, fmt.Errorf("%w: %s: expected an ed25519 private key in PEM format", ErrLockKeyInvalid, name)
+	}
+
+	return privateKey, nil
+}
+
+func readLockPublicKey(fs afero.Fs, name string) (ed25519.PublicKey, error) {
+	der, err := readPEMFile(fs, name)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKIXPublicKey(der)
+	publicKey, ok := key.(ed25519.PublicKey)
+	if err != nil || !ok {
+		return nil, fmt.Errorf("%w: %s: expected an ed25519 public key in PEM format", ErrLockKeyInvalid, name)
+	}
+
+	return publicKey, nil
+}
+
+func readPEMFile(fs afero.Fs, name string) ([]byte, error) {
+	b, err := afero.ReadFile(fs, name)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("%w: %s: expected PEM format", ErrLockKeyInvalid, name)
+	}
+
+	return block.Bytes, nil
+}
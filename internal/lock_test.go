@@ -0,0 +1,188 @@
+package internal
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"path"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLock(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+	th := NewTestHarness(t, fs)
+
+	dir1 := th.TempDir()
+	th.WriteFileString(path.Join(dir1, "a.tmpl"), "a")
+	th.WriteFileString(path.Join(dir1, "b", "c.tmpl"), "c")
+	th.WriteFileString(path.Join(dir1, ".wh.d.tmpl"), "")
+
+	dir2 := th.TempDir()
+	th.WriteFileString(path.Join(dir2, "a.tmpl"), "lower a")
+	th.WriteFileString(path.Join(dir2, "d.tmpl"), "d")
+	th.WriteFileString(path.Join(dir2, "e.tmpl"), "e")
+
+	// Check that every readable file is locked with the content that is read.
+	lock, err := NewLock(th.NewMounts(dir2+":/lib", dir1+":/lib"))
+	require.NoError(t, err)
+	assert.Equal(t, sha256Hex("a"), lock.hashes["/lib/a.tmpl"])
+	assert.Equal(t, sha256Hex("c"), lock.hashes["/lib/b/c.tmpl"])
+	assert.Equal(t, sha256Hex("e"), lock.hashes["/lib/e.tmpl"])
+	assert.NotContains(t, lock.hashes, "/lib/d.tmpl")
+	assert.NotContains(t, lock.hashes, "/lib/.wh.d.tmpl")
+	assert.NotContains(t, lock.hashes, "/std/VERSION")
+
+	// Check that the lockfile can be loaded again.
+	lockfile := path.Join(th.TempDir(), "tmpl.lock")
+	require.NoError(t, WriteLock(fs, lockfile, lock, ""))
+	assert.Contains(t, th.ReadFileString(lockfile), sha256Hex("a")+"  /lib/a.tmpl\n")
+
+	loaded, err := LoadLock(fs, lockfile, "")
+	require.NoError(t, err)
+	assert.Equal(t, lock.hashes, loaded.hashes)
+
+	require.NoError(t, loaded.verify("/lib/a.tmpl", []byte("a")))
+	assert.ErrorIs(t, loaded.verify("/lib/a.tmpl", []byte("changed")), ErrLockMismatch)
+	assert.ErrorIs(t, loaded.verify("/lib/new.tmpl", []byte("new")), ErrLockMismatch)
+}
+
+func TestLockWithSignature(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+	th := NewTestHarness(t, fs)
+	dir := th.TempDir()
+	th.WriteFileString(path.Join(dir, "lib", "a.tmpl"), "a")
+
+	// Write a key pair.
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	require.NoError(t, err)
+	publicDER, err := x509.MarshalPKIXPublicKey(publicKey)
+	require.NoError(t, err)
+
+	privateKeyFile := path.Join(dir, "key.pem")
+	publicKeyFile := path.Join(dir, "pub.pem")
+	th.WriteFileString(privateKeyFile, string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER})))
+	th.WriteFileString(publicKeyFile, string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})))
+
+	// Check that a signed lockfile is verified.
+	lock, err := NewLock(th.NewMounts(path.Join(dir, "lib") + ":/lib"))
+	require.NoError(t, err)
+	lockfile := path.Join(dir, "tmpl.lock")
+	require.NoError(t, WriteLock(fs, lockfile, lock, privateKeyFile))
+
+	_, err = LoadLock(fs, lockfile, publicKeyFile)
+	require.NoError(t, err)
+
+	// Check that a changed lockfile is rejected.
+	th.WriteFileString(lockfile, th.ReadFileString(lockfile)+sha256Hex("b")+"  /lib/b.tmpl\n")
+	_, err = LoadLock(fs, lockfile, publicKeyFile)
+	assert.ErrorIs(t, err, ErrLockSignatureInvalid)
+
+	// Check that the keys must be ed25519 keys.
+	_, err = LoadLock(fs, lockfile, privateKeyFile)
+	assert.ErrorIs(t, err, ErrLockKeyInvalid)
+	err = WriteLock(fs, lockfile, lock, lockfile)
+	assert.ErrorIs(t, err, ErrLockKeyInvalid)
+}
+
+func TestLoadLockWhenInvalid(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+	th := NewTestHarness(t, fs)
+	dir := th.TempDir()
+
+	tests := map[string]string{
+		"missing path":  sha256Hex("a") + "\n",
+		"relative path": sha256Hex("a") + "  lib/a.tmpl\n",
+		"invalid hash":  "abc  /lib/a.tmpl\n",
+	}
+
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			lockfile := path.Join(dir, name+".lock")
+			th.WriteFileString(lockfile, content)
+
+			_, err := LoadLock(fs, lockfile, "")
+			require.ErrorIs(t, err, ErrLockInvalid)
+			assert.Contains(t, err.Error(), lockfile+":1")
+		})
+	}
+}
+
+func TestExecuteWhenLocked(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+	th := NewTestHarness(t, fs)
+	dir := th.TempDir()
+	th.WriteFileString(path.Join(dir, "a.tmpl"), `{{ include "b.tmpl" . }} {{ includeText "c.txt" }}`)
+	th.WriteFileString(path.Join(dir, "b.tmpl"), `{{ .Name }}`)
+	th.WriteFileString(path.Join(dir, "c.txt"), "c")
+
+	configFilename := path.Join(th.TempDir(), "config.yml")
+	th.WriteFileString(configFilename, "Config:\n  Name: b")
+
+	mountSpecs := []string{dir + ":/lib"}
+	lock, err := NewLock(th.NewMounts(mountSpecs...))
+	require.NoError(t, err)
+
+	// Check that unchanged files can be read.
+	opts := DefaultOptions()
+	opts.Lock = lock
+	outFilename := path.Join(th.TempDir(), "out")
+	s, _ := th.ExecuteString("/lib/a.tmpl", mountSpecs, []string{configFilename}, outFilename, opts)
+	assert.Equal(t, "b c", s)
+
+	// Check that inline files are not locked.
+	opts.Inline = []string{"/lib/c.txt=inline"}
+	s, _ = th.ExecuteString("/lib/a.tmpl", mountSpecs, []string{configFilename}, outFilename, opts)
+	assert.Equal(t, "b inline", s)
+
+	// Check that a changed file fails.
+	th.WriteFileString(path.Join(dir, "b.tmpl"), `{{ .Name }}!`)
+	_, err = Execute(fs, "/lib/a.tmpl", mountSpecs, []string{configFilename}, outFilename, DefaultOptions())
+	require.NoError(t, err)
+
+	opts.Inline = nil
+	_, err = Execute(fs, "/lib/a.tmpl", mountSpecs, []string{configFilename}, outFilename, opts)
+	require.ErrorIs(t, err, ErrLockMismatch)
+	assert.Contains(t, err.Error(), "/lib/b.tmpl")
+}
+
+func TestExecuteWhenLockedWithStd(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+	th := NewTestHarness(t, fs)
+	dir := th.TempDir()
+	th.WriteFileString(path.Join(dir, "a.tmpl"), `{{ includeText "/std/VERSION" | trim }}`)
+
+	mountSpecs := []string{dir + ":/lib"}
+	lock, err := NewLock(th.NewMounts(mountSpecs...))
+	require.NoError(t, err)
+
+	// Check that the built-in library is not locked.
+	opts := DefaultOptions()
+	opts.Lock = lock
+	outFilename := path.Join(th.TempDir(), "out")
+	s, _ := th.ExecuteString("/lib/a.tmpl", mountSpecs, nil, outFilename, opts)
+	assert.Equal(t, "1.0.0", s)
+
+	// Check that a mount replacing a file of the built-in library is locked.
+	th.WriteFileString(path.Join(dir, "VERSION"), "2.0.0")
+	mountSpecs = append(mountSpecs, path.Join(dir, "VERSION")+":/std/VERSION")
+	_, err = Execute(fs, "/lib/a.tmpl", mountSpecs, nil, outFilename, opts)
+	require.ErrorIs(t, err, ErrLockMismatch)
+	assert.Contains(t, err.Error(), "/std/VERSION")
+}
@@ -1,46 +1,121 @@
 package internal
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path"
 	"path/filepath"
-	"slices"
 	"strings"
+	"sync"
 
 	"github.com/spf13/afero"
 )
 
 func NewMount(fs afero.Fs, spec string) (*Mount, error) {
+	// Check for a git revision of a repository.
+	spec, isGit := strings.CutPrefix(spec, "git:")
+
 	// Check the mount format.
-	paths := strings.Split(spec, ":")
-	if len(paths) != 2 || paths[0] == "" || paths[1] == "" {
-		return nil, fmt.Errorf("%w: format must be 'source:target'", ErrMountInvalid)
+	paths := strings.SplitN(spec, ":", 3)
+	if len(paths) < 2 || paths[0] == "" || paths[1] == "" {
+		return nil, fmt.Errorf("%w: format must be 'source:target[:options]'", ErrMountInvalid)
+	}
+
+	// Parse the options.
+	var options string
+	if len(paths) == 3 {
+		options = paths[2]
+	}
+	opts, err := parseMountOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	// Skip optional mounts when the source is missing.
+	mount, err := newMount(fs, paths[0], paths[1], isGit, opts)
+	if opts.optional && errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrMountSkipped, err)
+	}
+
+	return mount, err
+}
+
+func newMount(fs afero.Fs, source string, target string, isGit bool, opts *mountOptions) (*Mount, error) {
+	// Mount git revisions and archives through a filesystem holding their
+	// files.
+	hostPath := ""
+	var revision *GitRevision
+	archivePath, member, isArchive := cutArchiveSource(source)
+	if isGit {
+		var repoPath, rev string
+		repoPath, rev, member = cutGitSource(source)
+		repoPath, err := filepath.Abs(repoPath)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(repoPath); err != nil {
+			return nil, err
+		}
+
+		var commit string
+		fs, commit, err = newGitFs(repoPath, rev)
+		if err != nil {
+			return nil, err
+		}
+		revision = &GitRevision{Repository: repoPath, Revision: rev, Commit: commit}
+		hostPath = repoPath + "@" + commit
+		source = archiveSourcePath(member)
+	} else if isArchive {
+		archivePath, err := filepath.Abs(archivePath)
+		if err != nil {
+			return nil, err
+		}
+		hostPath = archivePath
+
+		fs, err = newArchiveFs(fs, archivePath)
+		if err != nil {
+			return nil, err
+		}
+		source = archiveSourcePath(member)
 	}
 
+	mount, err := newSourceMount(fs, hostPath, source, target, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	mount.revision = revision
+	return mount, nil
+}
+
+func newSourceMount(fs afero.Fs, hostPath string, source string, target string, opts *mountOptions) (*Mount, error) {
 	// Check that the source path is valid.
-	sourceEndsWithSeparator := strings.HasSuffix(paths[0], string(filepath.Separator))
-	sourcePath, err := filepath.Abs(paths[0])
+	sourceEndsWithSeparator := strings.HasSuffix(source, string(filepath.Separator))
+	sourcePath, err := filepath.Abs(source)
 	if err != nil {
 		return nil, err
 	}
 
 	// Check if the source exists.
-	source, err := fs.Stat(sourcePath)
+	sourceInfo, err := fs.Stat(sourcePath)
 	if err != nil {
+		if hostPath != "" {
+			return nil, fmt.Errorf("%w: %s", os.ErrNotExist, archiveHostPath(hostPath, sourcePath))
+		}
 		return nil, err
 	}
 
 	// Check that the target path is valid.
-	targetEndsWithSeparator := strings.HasSuffix(paths[1], string(filepath.Separator))
-	targetPath := filepath.Clean(paths[1])
+	targetEndsWithSeparator := strings.HasSuffix(target, string(filepath.Separator))
+	targetPath := filepath.Clean(target)
 	if !path.IsAbs(targetPath) {
 		return nil, fmt.Errorf("%w: mount target: %s", ErrAbsolutePathRequired, targetPath)
 	}
 
 	// Check if source file is mounted as a directory.
-	if !source.IsDir() && sourceEndsWithSeparator {
-		return nil, fmt.Errorf("%w: source file mounted as directory: %s", ErrMountInvalid, sourcePath)
+	if !sourceInfo.IsDir() && sourceEndsWithSeparator {
+		return nil, fmt.Errorf("%w: source file mounted as directory: %s", ErrMountInvalid, archiveHostPath(hostPath, sourcePath))
 	}
 
 	// If the target path ends in a separator and the source path does not, then
@@ -50,100 +125,199 @@ func NewMount(fs afero.Fs, spec string) (*Mount, error) {
 		targetPath = filepath.Join(targetPath, filepath.Base(sourcePath))
 	}
 
-	// Create a path converter.
-	pathConverter := NewPathConverter(sourcePath, targetPath)
-
-	// Check if file or directory.
-	var targetDirs []string
-	var targetFiles []string
-	if source.IsDir() {
-		// List directories in the mount.
-		if err := listDirs(fs, sourcePath, &targetDirs, pathConverter.SourceToTargetPath); err != nil {
-			return nil, err
-		}
-
-		// List files in the mount.
-		if err := listFiles(fs, sourcePath, &targetFiles, pathConverter.SourceToTargetPath); err != nil {
-			return nil, err
-		}
-	} else {
-		targetFile, err := pathConverter.SourceToTargetPath(sourcePath)
-		if err != nil {
-			return nil, err
-		}
-
-		targetFiles = append(targetFiles, targetFile)
+	// Check if a mounted file is a whiteout.
+	whiteout := ""
+	if hidden, ok := cutWhiteout(path.Base(targetPath)); ok && !sourceInfo.IsDir() {
+		whiteout = path.Join(path.Dir(targetPath), hidden)
 	}
 
-	// Sort to enable binary search.
-	slices.Sort(targetDirs)
-	slices.Sort(targetFiles)
+	// Create a path converter.
+	pathConverter := NewPathConverter(sourcePath, targetPath)
 
-	// Create the mount.
+	// Create the mount. Directories are indexed when first used.
 	return &Mount{
 		fs:            fs,
+		hostPath:      hostPath,
+		options:       opts,
 		sourcePath:    sourcePath,
 		targetPath:    targetPath,
-		targetDirs:    targetDirs,
-		targetFiles:   targetFiles,
 		pathConverter: pathConverter,
-		directory:     source.IsDir(),
+		directory:     sourceInfo.IsDir(),
+		whiteout:      whiteout,
 	}, nil
 }
 
 type Mount struct {
 	fs            afero.Fs
+	hostPath      string
+	revision      *GitRevision
+	options       *mountOptions
 	sourcePath    string
 	targetPath    string
-	targetDirs    []string
-	targetFiles   []string
 	pathConverter *PathConverter
 	directory     bool
+	whiteout      string
+	std           bool
+	index         *mountIndex
+	indexErr      error
+	indexOnce     sync.Once
 }
 
-func (m *Mount) Dirs(pattern string, directories *[]string, excludeFns []func(string) bool) error {
-	// Match files.
-	for _, targetDir := range m.targetDirs {
-		// Check if the target directory is excluded.
-		if exclude(targetDir, excludeFns) {
-			continue
+func (m *Mount) loadIndex() (*mountIndex, error) {
+	m.indexOnce.Do(func() {
+		// Filter the directories and files with the options and ignore file.
+		filter, err := newMountFilter(m.fs, m.sourcePath, m.options)
+		if err != nil {
+			m.indexErr = err
+			return
 		}
 
-		// Check if the directory matches the pattern.
-		if match, err := filepath.Match(pattern, targetDir); err != nil {
-			return err
-		} else if match {
-			*directories = append(*directories, targetDir)
-		}
+		m.index, m.indexErr = buildMountIndex(m.fs, m.sourcePath, filter, m.options.symlinks)
+	})
+
+	return m.index, m.indexErr
+}
+
+func (m *Mount) Dirs(pattern string, directories *[]string, excludeFns []func(string) bool) error {
+	glob, err := NewGlob(pattern)
+	if err != nil {
+		return err
 	}
 
-	// Success.
-	return nil
+	return m.dirs(glob, directories, excludeFns)
+}
+
+func (m *Mount) dirs(glob *Glob, directories *[]string, excludeFns []func(string) bool) error {
+	return m.match(glob, true, func(targetDir string) {
+		*directories = append(*directories, targetDir)
+	}, excludeFns)
 }
 
 func (m *Mount) Files(pattern string, files *[]string, excludeFns []func(string) bool) error {
-	// Match files.
-	for _, targetFile := range m.targetFiles {
-		// Check if the target file is excluded.
-		if exclude(targetFile, excludeFns) {
-			continue
+	glob, err := NewGlob(pattern)
+	if err != nil {
+		return err
+	}
+
+	return m.files(glob, files, excludeFns)
+}
+
+func (m *Mount) files(glob *Glob, files *[]string, excludeFns []func(string) bool) error {
+	return m.match(glob, false, func(targetFile string) {
+		*files = append(*files, targetFile)
+	}, excludeFns)
+}
+
+func (m *Mount) match(glob *Glob, dirs bool, fn func(string), excludeFns []func(string) bool) error {
+	// Check a mounted file.
+	if !m.directory {
+		if !dirs && m.whiteout == "" && !exclude(m.targetPath, excludeFns) && glob.Match(m.targetPath) {
+			fn(m.targetPath)
 		}
+		return nil
+	}
+
+	// Search the subtrees of the index that can match the patterns.
+	roots := searchRoots(m.targetPath, glob, m.std)
+	if len(roots) == 0 {
+		return nil
+	}
 
-		// Check if the file matches the pattern.
-		if match, err := filepath.Match(pattern, targetFile); err != nil {
-			return err
-		} else if match {
-			*files = append(*files, targetFile)
+	index, err := m.loadIndex()
+	if err != nil {
+		return err
+	}
+
+	for _, root := range roots {
+		rel, _ := cutTargetPath(m.targetPath, root)
+		node := index.lookup(rel)
+		if node == nil {
+			continue
 		}
+
+		node.walk(root, func(p string, isDir bool) {
+			// Check if the path is excluded or does not match the patterns.
+			if isDir == dirs && !exclude(p, excludeFns) && glob.Match(p) {
+				fn(p)
+			}
+		})
 	}
 
 	// Success.
 	return nil
 }
 
-func (m *Mount) ReadFileString(targetPath string) (string, error) {
-	_, ok := slices.BinarySearch(m.targetFiles, targetPath)
+func (m *Mount) hasFile(targetPath string) (bool, error) {
+	if !m.directory {
+		return m.whiteout == "" && targetPath == m.targetPath, nil
+	}
+
+	// Look up files of directories in the index.
+	rel, ok := cutTargetPath(m.targetPath, targetPath)
+	if !ok || rel == "" {
+		return false, nil
+	}
+
+	index, err := m.loadIndex()
+	if err != nil {
+		return false, err
+	}
+
+	return index.hasFile(rel), nil
+}
+
+func (m *Mount) hasPath(targetPath string) (bool, error) {
+	if !m.directory {
+		return m.whiteout == "" && targetPath == m.targetPath, nil
+	}
+
+	// Look up files and directories in the index.
+	rel, ok := cutTargetPath(m.targetPath, targetPath)
 	if !ok {
+		return false, nil
+	}
+
+	index, err := m.loadIndex()
+	if err != nil {
+		return false, err
+	}
+
+	return index.lookup(rel) != nil || index.hasFile(rel) || index.hasLink(rel), nil
+}
+
+func (m *Mount) Stat(targetPath string) (*FileInfo, error) {
+	// Check that the path is mounted.
+	if ok, err := m.hasPath(targetPath); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, fmt.Errorf("%w: %s", os.ErrNotExist, targetPath)
+	}
+
+	sourcePath, err := m.pathConverter.TargetToSourcePath(targetPath)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := m.fs.Stat(sourcePath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading source file: %w: %s", err, archiveHostPath(m.hostPath, sourcePath))
+	}
+
+	return &FileInfo{
+		Path:    targetPath,
+		Size:    info.Size(),
+		Mode:    info.Mode(),
+		ModTime: info.ModTime(),
+		IsDir:   info.IsDir(),
+		Source:  archiveHostPath(m.hostPath, sourcePath),
+	}, nil
+}
+
+func (m *Mount) Readlink(targetPath string) (string, error) {
+	// Check that the path is mounted.
+	if ok, err := m.hasPath(targetPath); err != nil {
+		return "", err
+	} else if !ok {
 		return "", fmt.Errorf("%w: %s", os.ErrNotExist, targetPath)
 	}
 
@@ -152,60 +326,57 @@ func (m *Mount) ReadFileString(targetPath string) (string, error) {
 		return "", err
 	}
 
-	b, err := afero.ReadFile(m.fs, sourcePath)
+	// Read the symlink, if the filesystem supports them.
+	reader, ok := m.fs.(afero.LinkReader)
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrSymlinkRequired, targetPath)
+	}
+
+	target, err := reader.ReadlinkIfPossible(sourcePath)
 	if err != nil {
-		return "", fmt.Errorf("error reading source file: %w: %s", err, sourcePath)
+		return "", fmt.Errorf("%w: %s", ErrSymlinkRequired, targetPath)
 	}
 
-	return string(b), nil
+	return target, nil
 }
 
-func listDirs(fs afero.Fs, sourcePath string, directories *[]string, pathConverter func(string) (string, error)) error {
-	return afero.Walk(fs, sourcePath, func(p string, d os.FileInfo, err error) error {
-		// Check if there was an error while walking.
-		if err != nil {
-			return err
-		}
+func (m *Mount) ReadFile(targetPath string) ([]byte, error) {
+	// Check that the file is mounted.
+	if ok, err := m.hasFile(targetPath); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, fmt.Errorf("%w: %s", os.ErrNotExist, targetPath)
+	}
 
-		// Skip files.
-		if !d.IsDir() {
-			return nil
-		}
+	sourcePath, err := m.pathConverter.TargetToSourcePath(targetPath)
+	if err != nil {
+		return nil, err
+	}
 
-		// Convert the file path.
-		targetPath, err := pathConverter(p)
-		if err != nil {
-			return err
-		}
+	b, err := afero.ReadFile(m.fs, sourcePath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading source file: %w: %s", err, archiveHostPath(m.hostPath, sourcePath))
+	}
 
-		// Add the file to the list.
-		*directories = append(*directories, targetPath)
-		return nil
-	})
+	return b, nil
 }
 
-func listFiles(fs afero.Fs, sourcePath string, files *[]string, pathConverter func(string) (string, error)) error {
-	return afero.Walk(fs, sourcePath, func(p string, d os.FileInfo, err error) error {
-		// Check if there was an error while walking.
-		if err != nil {
-			return err
-		}
+func (m *Mount) ReadFileString(targetPath string) (string, error) {
+	b, err := m.ReadFile(targetPath)
+	if err != nil {
+		return "", err
+	}
 
-		// Skip directories.
-		if d.IsDir() {
-			return nil
-		}
+	return string(b), nil
+}
 
-		// Convert the file path.
-		targetPath, err := pathConverter(p)
-		if err != nil {
-			return err
-		}
+func archiveHostPath(archivePath string, sourcePath string) string {
+	// Show members of archives as 'archive!member'.
+	if archivePath == "" {
+		return sourcePath
+	}
 
-		// Add the file to the list.
-		*files = append(*files, targetPath)
-		return nil
-	})
+	return archivePath + "!" + strings.TrimPrefix(sourcePath, "/")
 }
 
 func exclude(s string, fns []func(string) bool) bool {
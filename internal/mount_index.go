@@ -0,0 +1,262 @@
+package internal
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/spf13/afero"
+)
+
+type mountIndex struct {
+	dirs      map[string]*mountIndex
+	files     []string
+	links     []string
+	whiteouts []string
+}
+
+func newMountIndex() *mountIndex {
+	return &mountIndex{dirs: map[string]*mountIndex{}}
+}
+
+type mountIndexer struct {
+	fs         afero.Fs
+	filter     *mountFilter
+	symlinks   string
+	sourcePath string
+	sem        chan struct{}
+	wg         sync.WaitGroup
+	mu         sync.Mutex
+	err        error
+}
+
+func buildMountIndex(fs afero.Fs, sourcePath string, filter *mountFilter, symlinks string) (*mountIndex, error) {
+	// Resolve the source so that symlinks can be compared with it.
+	realSourcePath, err := evalSymlinks(fs, sourcePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Limit the number of directories read at the same time.
+	indexer := &mountIndexer{
+		fs:         fs,
+		filter:     filter,
+		symlinks:   symlinks,
+		sourcePath: realSourcePath,
+		sem:        make(chan struct{}, 4*runtime.GOMAXPROCS(0)),
+	}
+
+	root := newMountIndex()
+	indexer.wg.Add(1)
+	go indexer.visit(root, sourcePath, "", []string{realSourcePath})
+	indexer.wg.Wait()
+
+	if indexer.err != nil {
+		return nil, indexer.err
+	}
+
+	return root, nil
+}
+
+func (i *mountIndexer) visit(node *mountIndex, sourceDir string, rel string, realDirs []string) {
+	// Read each directory in its own goroutine. Only the goroutine of a
+	// directory changes its node, so the nodes do not need a lock.
+	defer i.wg.Done()
+
+	i.sem <- struct{}{}
+	infos, err := afero.ReadDir(i.fs, sourceDir)
+	<-i.sem
+	if err != nil {
+		i.fail(err)
+		return
+	}
+
+	for _, info := range infos {
+		name := info.Name()
+		childRel := path.Join(rel, name)
+		childSource := filepath.Join(sourceDir, name)
+		childReal := filepath.Join(realDirs[len(realDirs)-1], name)
+		isDir := info.IsDir()
+		isSymlink := info.Mode()&os.ModeSymlink != 0
+
+		// Skip symlinks that are filtered whether they point to a file or a
+		// directory without resolving them.
+		if isSymlink && i.filter.skip(childRel, false) && i.filter.skip(childRel, true) {
+			continue
+		}
+
+		// Preserve symlinks to files as files. Other symlinks can only be read
+		// with readlink, so they are not listed.
+		if isSymlink && i.symlinks == symlinksPreserve {
+			targetInfo, err := i.fs.Stat(childSource)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				i.fail(err)
+				return
+			}
+
+			if err != nil || targetInfo.IsDir() {
+				if !i.filter.skip(childRel, false) {
+					node.links = append(node.links, name)
+				}
+				continue
+			}
+		}
+
+		// Resolve symlinks unless they are preserved.
+		if isSymlink && i.symlinks != symlinksPreserve {
+			target, err := evalSymlinks(i.fs, childSource)
+			if errors.Is(err, os.ErrNotExist) {
+				// Skip broken symlinks.
+				continue
+			} else if err != nil {
+				i.fail(err)
+				return
+			}
+
+			// Skip symlinks that escape the source.
+			if _, ok := cutTargetPath(i.sourcePath, target); !ok && i.symlinks == symlinksContain {
+				continue
+			}
+
+			targetInfo, err := i.fs.Stat(childSource)
+			if err != nil {
+				i.fail(err)
+				return
+			}
+
+			// Skip symlinks to a directory that contains them.
+			isDir = targetInfo.IsDir()
+			if isDir && slices.Contains(realDirs, target) {
+				continue
+			}
+			childReal = target
+		}
+
+		// Skip filtered directories and files.
+		if i.filter.skip(childRel, isDir) {
+			continue
+		}
+
+		if isDir {
+			child := newMountIndex()
+			node.dirs[name] = child
+			i.wg.Add(1)
+			go i.visit(child, childSource, childRel, append(slices.Clip(realDirs), childReal))
+		} else if hidden, ok := cutWhiteout(name); ok {
+			node.whiteouts = append(node.whiteouts, hidden)
+		} else {
+			node.files = append(node.files, name)
+		}
+	}
+}
+
+func (i *mountIndexer) fail(err error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.err == nil {
+		i.err = err
+	}
+}
+
+func evalSymlinks(fs afero.Fs, name string) (string, error) {
+	// Only the host filesystem has symlinks.
+	if _, ok := fs.(*afero.OsFs); !ok {
+		return name, nil
+	}
+
+	return filepath.EvalSymlinks(name)
+}
+
+func (idx *mountIndex) lookup(rel string) *mountIndex {
+	node := idx
+	if rel == "" {
+		return node
+	}
+
+	for _, name := range strings.Split(rel, "/") {
+		node = node.dirs[name]
+		if node == nil {
+			return nil
+		}
+	}
+
+	return node
+}
+
+func (idx *mountIndex) hasFile(rel string) bool {
+	dir, name := path.Split(rel)
+	node := idx.lookup(strings.TrimSuffix(dir, "/"))
+	if node == nil {
+		return false
+	}
+
+	_, ok := slices.BinarySearch(node.files, name)
+	return ok
+}
+
+func (idx *mountIndex) hasLink(rel string) bool {
+	dir, name := path.Split(rel)
+	node := idx.lookup(strings.TrimSuffix(dir, "/"))
+	if node == nil {
+		return false
+	}
+
+	_, ok := slices.BinarySearch(node.links, name)
+	return ok
+}
+
+func (idx *mountIndex) walk(dir string, fn func(p string, isDir bool)) {
+	// Visit the directory, its files and then its subdirectories in order.
+	fn(dir, true)
+	for _, name := range idx.files {
+		fn(path.Join(dir, name), false)
+	}
+	for _, name := range sortedKeys(idx.dirs) {
+		idx.dirs[name].walk(path.Join(dir, name), fn)
+	}
+}
+
+func searchRoots(targetPath string, glob *Glob, explicit bool) []string {
+	// Only the subtrees below the literal prefix of a pattern can match. An
+	// explicit mount is only searched by patterns that start inside it.
+	var roots []string
+	for _, pattern := range glob.includes {
+		base, _ := doublestar.SplitPattern(pattern)
+		if _, ok := cutTargetPath(targetPath, base); ok {
+			roots = append(roots, base)
+		} else if _, ok := cutTargetPath(base, targetPath); ok && !explicit {
+			roots = append(roots, targetPath)
+		}
+	}
+
+	// Drop roots inside other roots so that each path is visited once.
+	slices.Sort(roots)
+	roots = slices.Compact(roots)
+	return slices.DeleteFunc(roots, func(root string) bool {
+		for _, other := range roots {
+			if _, ok := cutTargetPath(other, root); ok && other != root {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func cutTargetPath(dir string, p string) (string, bool) {
+	// Return the path relative to the directory, if it is inside it.
+	if p == dir {
+		return "", true
+	}
+	if dir != "/" {
+		dir = appendPathSeparator(dir)
+	}
+
+	return strings.CutPrefix(p, dir)
+}
@@ -0,0 +1,189 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/spf13/afero"
+)
+
+const ignoreFilename = ".tmplignore"
+
+const (
+	symlinksFollow   = "follow"
+	symlinksContain  = "contain"
+	symlinksPreserve = "preserve"
+)
+
+type mountOptions struct {
+	includes []string
+	excludes []string
+	optional bool
+	symlinks string
+}
+
+func newMountOptions() *mountOptions {
+	return &mountOptions{symlinks: symlinksContain}
+}
+
+func parseMountOptions(s string) (*mountOptions, error) {
+	opts := newMountOptions()
+	if s == "" {
+		return opts, nil
+	}
+
+	for _, option := range splitMountOptions(s) {
+		name, value, hasValue := strings.Cut(option, "=")
+		switch {
+		case name == "include" && hasValue:
+			if !doublestar.ValidatePattern(value) {
+				return nil, fmt.Errorf("%w: invalid include pattern: %s", ErrMountInvalid, value)
+			}
+			opts.includes = append(opts.includes, value)
+		case name == "exclude" && hasValue:
+			if !doublestar.ValidatePattern(value) {
+				return nil, fmt.Errorf("%w: invalid exclude pattern: %s", ErrMountInvalid, value)
+			}
+			opts.excludes = append(opts.excludes, value)
+		case name == "optional" && !hasValue:
+			opts.optional = true
+		case name == "symlinks" && hasValue:
+			if value != symlinksFollow && value != symlinksContain && value != symlinksPreserve {
+				return nil, fmt.Errorf("%w: symlinks must be 'follow', 'contain' or 'preserve': %s", ErrMountInvalid, value)
+			}
+			opts.symlinks = value
+		default:
+			return nil, fmt.Errorf("%w: unknown option: %s", ErrMountInvalid, option)
+		}
+	}
+
+	return opts, nil
+}
+
+func splitMountOptions(s string) []string {
+	// Split on commas that are not inside braces, e.g. 'include=*.{yml,yaml}'.
+	var options []string
+	depth, start := 0, 0
+	for i, r := range s {
+		switch r {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				options = append(options, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+
+	return append(options, s[start:])
+}
+
+type ignoreRule struct {
+	pattern string
+	negate  bool
+	dirOnly bool
+}
+
+func readIgnoreFile(fs afero.Fs, name string) ([]ignoreRule, error) {
+	// The ignore file is optional.
+	b, err := afero.ReadFile(fs, name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Parse the rules, which follow the syntax of .gitignore files.
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var rule ignoreRule
+		line, rule.negate = strings.CutPrefix(line, "!")
+		line, rule.dirOnly = strings.CutSuffix(line, "/")
+
+		// Patterns without a separator match at any depth.
+		if p, anchored := strings.CutPrefix(line, "/"); anchored {
+			line = p
+		} else if !strings.Contains(line, "/") {
+			line = "**/" + line
+		}
+
+		if !doublestar.ValidatePattern(line) {
+			return nil, fmt.Errorf("%w: %s: invalid pattern: %s", ErrMountInvalid, name, line)
+		}
+		rule.pattern = line
+		rules = append(rules, rule)
+	}
+
+	return rules, scanner.Err()
+}
+
+type mountFilter struct {
+	includes []string
+	excludes []string
+	ignores  []ignoreRule
+}
+
+func (f *mountFilter) skip(rel string, dir bool) bool {
+	// Never list the ignore file itself.
+	if rel == ignoreFilename {
+		return true
+	}
+
+	// Check the exclude patterns.
+	for _, pattern := range f.excludes {
+		if doublestar.MatchUnvalidated(pattern, rel) {
+			return true
+		}
+	}
+
+	// Check the ignore rules, where the last matching rule wins.
+	ignored := false
+	for _, rule := range f.ignores {
+		if (!rule.dirOnly || dir) && doublestar.MatchUnvalidated(rule.pattern, rel) {
+			ignored = !rule.negate
+		}
+	}
+	if ignored {
+		return true
+	}
+
+	// Check the include patterns, which only apply to files.
+	if dir || len(f.includes) == 0 {
+		return false
+	}
+	for _, pattern := range f.includes {
+		if doublestar.MatchUnvalidated(pattern, rel) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func newMountFilter(fs afero.Fs, sourcePath string, opts *mountOptions) (*mountFilter, error) {
+	ignores, err := readIgnoreFile(fs, path.Join(sourcePath, ignoreFilename))
+	if err != nil {
+		return nil, err
+	}
+
+	return &mountFilter{
+		includes: opts.includes,
+		excludes: opts.excludes,
+		ignores:  ignores,
+	}, nil
+}
@@ -0,0 +1,115 @@
+package internal
+
+import (
+	"path"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestMountOptionsDir(th *TestHarness) string {
+	dir := th.TempDir()
+	th.WriteFileString(path.Join(dir, "a.tmpl"), "")
+	th.WriteFileString(path.Join(dir, "a.tmpl.bak"), "")
+	th.WriteFileString(path.Join(dir, "b.yml"), "")
+	th.WriteFileString(path.Join(dir, "c.yaml"), "")
+	th.WriteFileString(path.Join(dir, "sub", "d.tmpl"), "")
+	th.WriteFileString(path.Join(dir, "sub", ".d.tmpl.swp"), "")
+	th.WriteFileString(path.Join(dir, "node_modules", "e", "f.tmpl"), "")
+	th.WriteFileString(path.Join(dir, ".git", "HEAD"), "")
+	return dir
+}
+
+func TestMountWithOptions(t *testing.T) {
+	t.Parallel()
+
+	th := NewTestHarness(t, afero.NewMemMapFs())
+	dir := newTestMountOptionsDir(th)
+
+	tests := []struct {
+		options string
+		files   []string
+		dirs    []string
+	}{
+		{
+			options: "exclude=**/*.bak,exclude=**/.*.swp,exclude=node_modules,exclude=.git",
+			files:   []string{"/lib/a.tmpl", "/lib/b.yml", "/lib/c.yaml", "/lib/sub/d.tmpl"},
+			dirs:    []string{"/lib", "/lib/sub"},
+		},
+		{
+			options: "include=**/*.tmpl,exclude=node_modules",
+			files:   []string{"/lib/a.tmpl", "/lib/sub/d.tmpl"},
+			dirs:    []string{"/lib", "/lib/.git", "/lib/sub"},
+		},
+		{
+			options: "include=*.{yml,yaml}",
+			files:   []string{"/lib/b.yml", "/lib/c.yaml"},
+			dirs:    []string{"/lib", "/lib/.git", "/lib/node_modules", "/lib/node_modules/e", "/lib/sub"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.options, func(t *testing.T) {
+			t.Parallel()
+
+			m := th.NewMount(dir + ":/lib:" + test.options)
+			assert.Equal(t, test.files, mountFiles(t, m))
+			assert.Equal(t, test.dirs, mountDirs(t, m))
+		})
+	}
+}
+
+func TestMountWithIgnoreFile(t *testing.T) {
+	t.Parallel()
+
+	th := NewTestHarness(t, afero.NewMemMapFs())
+	dir := newTestMountOptionsDir(th)
+	th.WriteFileString(path.Join(dir, ignoreFilename), `# Version control and dependencies.
+.git/
+/node_modules
+
+# Backups and swap files, but keep the templates.
+*.bak
+.*.swp
+*.yaml
+!c.yaml
+`)
+
+	m := th.NewMount(dir + ":/lib")
+	assert.Equal(t, []string{"/lib/a.tmpl", "/lib/b.yml", "/lib/c.yaml", "/lib/sub/d.tmpl"}, mountFiles(t, m))
+	assert.Equal(t, []string{"/lib", "/lib/sub"}, mountDirs(t, m))
+}
+
+func TestMountWithInvalidOptions(t *testing.T) {
+	t.Parallel()
+
+	th := NewTestHarness(t, afero.NewMemMapFs())
+	dir := th.TempDir()
+
+	for _, options := range []string{"unknown", "optional=true", "include", "exclude=[", "include=a,"} {
+		t.Run(options, func(t *testing.T) {
+			t.Parallel()
+
+			err := th.NewMountExpectingError(dir + ":/lib:" + options)
+			assert.ErrorIs(t, err, ErrMountInvalid)
+		})
+	}
+}
+
+func TestMountWhenOptional(t *testing.T) {
+	t.Parallel()
+
+	th := NewTestHarness(t, afero.NewMemMapFs())
+	dir := th.TempDir()
+	th.WriteFileString(path.Join(dir, "a.tmpl"), "")
+
+	err := th.NewMountExpectingError(path.Join(dir, "missing") + ":/missing:optional")
+	assert.ErrorIs(t, err, ErrMountSkipped)
+
+	mounts := th.NewMounts(path.Join(dir, "missing")+":/missing:optional", dir+":/lib")
+	files, err := mounts.Files("/lib/*")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/lib/a.tmpl"}, files)
+}
@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"fmt"
 	"os"
 	"path"
 	"testing"
@@ -197,7 +198,7 @@ func TestMountFileAsChildOfTarget(t *testing.T) {
 	assert.ElementsMatch(t, files, []string{"/target/a"})
 }
 
-func TestListFiles(t *testing.T) {
+func TestMountIndex(t *testing.T) {
 	t.Parallel()
 
 	fs := afero.NewMemMapFs()
@@ -211,16 +212,261 @@ func TestListFiles(t *testing.T) {
 	th.WriteFileString(path.Join(dir, "c", "e"), "")
 	th.WriteFileString(path.Join(dir, "f"), "")
 
-	var files []string
-	err := listFiles(fs, dir, &files, func(p string) (string, error) {
-		return p, nil
+	index, err := buildMountIndex(fs, dir, &mountFilter{}, symlinksFollow)
+	require.NoError(t, err)
+
+	var paths []string
+	index.walk("/target", func(p string, isDir bool) {
+		paths = append(paths, fmt.Sprintf("%s %t", p, isDir))
 	})
-	assert.NoError(t, err)
-	assert.ElementsMatch(t, []string{
-		path.Join(dir, "a"),
-		path.Join(dir, "b"),
-		path.Join(dir, "c", "d"),
-		path.Join(dir, "c", "e"),
-		path.Join(dir, "f"),
+	assert.Equal(t, []string{
+		"/target true",
+		"/target/a false",
+		"/target/b false",
+		"/target/f false",
+		"/target/c true",
+		"/target/c/d false",
+		"/target/c/e false",
+	}, paths)
+
+	assert.True(t, index.hasFile("c/d"))
+	assert.False(t, index.hasFile("c"))
+	assert.False(t, index.hasFile("z/d"))
+}
+
+func TestMountIndexIsLazy(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+	th := NewTestHarness(t, fs)
+	dir := th.TempDir()
+	th.WriteFileString(path.Join(dir, "a"), "")
+
+	// The index is built on first use.
+	m := th.NewMount(dir + ":/target")
+	assert.Nil(t, m.index)
+
+	// Patterns outside the mount do not build the index.
+	var files []string
+	require.NoError(t, m.Files("/other/**", &files, nil))
+	assert.Nil(t, m.index)
+
+	// Files added before first use are found.
+	th.WriteFileString(path.Join(dir, "b"), "")
+	require.NoError(t, m.Files("/target/*", &files, nil))
+	assert.Equal(t, []string{"/target/a", "/target/b"}, files)
+	assert.NotNil(t, m.index)
+}
+
+func TestSearchRoots(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		targetPath string
+		patterns   []string
+		explicit   bool
+		expected   []string
+	}{
+		{"/lib", []string{"/lib/modules/**/*.tmpl"}, false, []string{"/lib/modules"}},
+		{"/lib", []string{"/**/*.tmpl"}, false, []string{"/lib"}},
+		{"/lib/modules", []string{"/lib/*/*.tmpl"}, false, []string{"/lib/modules"}},
+		{"/lib", []string{"/library/*"}, false, nil},
+		{"/lib", []string{"/lib/a/*", "/lib/a/b/*", "/lib/c/*"}, false, []string{"/lib/a", "/lib/c"}},
+		{"/", []string{"/lib/*"}, false, []string{"/lib"}},
+		{"/std", []string{"/**/*.tmpl"}, true, nil},
+		{"/std", []string{"/std/**/*.tmpl"}, true, []string{"/std"}},
+		{"/std", []string{"/std/license/*"}, true, []string{"/std/license"}},
+	}
+
+	for _, test := range tests {
+		glob, err := NewGlob(test.patterns...)
+		require.NoError(t, err)
+		assert.Equal(t, test.expected, searchRoots(test.targetPath, glob, test.explicit), "%s %v", test.targetPath, test.patterns)
+	}
+}
+
+func newBenchmarkTree(b *testing.B) (afero.Fs, string) {
+	// Create 20 modules with 20 components of 25 files each.
+	fs := afero.NewMemMapFs()
+	for i := range 20 {
+		for j := range 20 {
+			for k := range 25 {
+				name := fmt.Sprintf("/src/modules/m%02d/c%02d/f%02d.tmpl", i, j, k)
+				require.NoError(b, afero.WriteFile(fs, name, nil, 0644))
+			}
+		}
+	}
+
+	return fs, "/src"
+}
+
+func BenchmarkNewMount(b *testing.B) {
+	fs, dir := newBenchmarkTree(b)
+
+	b.ResetTimer()
+	for range b.N {
+		m, err := NewMount(fs, dir+":/lib")
+		require.NoError(b, err)
+		_, err = m.loadIndex()
+		require.NoError(b, err)
+	}
+}
+
+func BenchmarkMountsFilesWithLiteralPrefix(b *testing.B) {
+	fs, dir := newBenchmarkTree(b)
+	mounts, err := NewMounts(fs, []string{dir + ":/lib"})
+	require.NoError(b, err)
+
+	b.ResetTimer()
+	for range b.N {
+		files, err := mounts.Files("/lib/modules/m07/c03/*.tmpl")
+		require.NoError(b, err)
+		require.Len(b, files, 25)
+	}
+}
+
+func BenchmarkMountsFilesRecursive(b *testing.B) {
+	fs, dir := newBenchmarkTree(b)
+	mounts, err := NewMounts(fs, []string{dir + ":/lib"})
+	require.NoError(b, err)
+
+	b.ResetTimer()
+	for range b.N {
+		files, err := mounts.Files("/lib/**/f00.tmpl")
+		require.NoError(b, err)
+		require.Len(b, files, 400)
+	}
+}
+
+func mountFiles(t *testing.T, m *Mount) []string {
+	var files []string
+	require.NoError(t, m.Files("/**", &files, nil))
+	return files
+}
+
+func mountDirs(t *testing.T, m *Mount) []string {
+	var dirs []string
+	require.NoError(t, m.Dirs("/**", &dirs, nil))
+	return dirs
+}
+
+func newTestSymlinkDir(t *testing.T) (string, string) {
+	// Create a source with a symlinked file, a symlinked directory, a loop,
+	// a broken symlink and a symlink that escapes the source.
+	outside := t.TempDir()
+	require.NoError(t, os.WriteFile(path.Join(outside, "secret"), nil, 0644))
+
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(path.Join(dir, "modules", "git"), 0755))
+	require.NoError(t, os.WriteFile(path.Join(dir, "modules", "git", "a.tmpl"), nil, 0644))
+	require.NoError(t, os.Symlink("git", path.Join(dir, "modules", "scm")))
+	require.NoError(t, os.Symlink("a.tmpl", path.Join(dir, "modules", "git", "b.tmpl")))
+	require.NoError(t, os.Symlink("..", path.Join(dir, "modules", "git", "loop")))
+	require.NoError(t, os.Symlink("missing", path.Join(dir, "broken")))
+	require.NoError(t, os.Symlink(path.Join(outside, "secret"), path.Join(dir, "secret")))
+
+	return dir, outside
+}
+
+func TestMountWithSymlinks(t *testing.T) {
+	t.Parallel()
+
+	th := NewTestHarness(t, afero.NewOsFs())
+	dir, _ := newTestSymlinkDir(t)
+
+	// Follow symlinks, including the ones that escape the source.
+	m := th.NewMount(dir + ":/lib:symlinks=follow")
+	assert.Equal(t, []string{
+		"/lib/secret",
+		"/lib/modules/git/a.tmpl",
+		"/lib/modules/git/b.tmpl",
+		"/lib/modules/scm/a.tmpl",
+		"/lib/modules/scm/b.tmpl",
+	}, mountFiles(t, m))
+	assert.Equal(t, []string{"/lib", "/lib/modules", "/lib/modules/git", "/lib/modules/scm"}, mountDirs(t, m))
+
+	// Preserve symlinks to files as files and only list readable files.
+	m = th.NewMount(dir + ":/lib:symlinks=preserve")
+	files := mountFiles(t, m)
+	assert.Equal(t, []string{
+		"/lib/secret",
+		"/lib/modules/git/a.tmpl",
+		"/lib/modules/git/b.tmpl",
 	}, files)
+	assert.Equal(t, []string{"/lib", "/lib/modules", "/lib/modules/git"}, mountDirs(t, m))
+	for _, file := range files {
+		_, err := m.ReadFile(file)
+		assert.NoError(t, err, file)
+	}
+
+	// Check that the symlinks that are not listed can still be read.
+	for link, expected := range map[string]string{
+		"/lib/broken":           "missing",
+		"/lib/modules/scm":      "git",
+		"/lib/modules/git/loop": "..",
+	} {
+		target, err := m.Readlink(link)
+		require.NoError(t, err, link)
+		assert.Equal(t, expected, target)
+
+		_, err = m.ReadFile(link)
+		assert.ErrorIs(t, err, os.ErrNotExist, link)
+	}
+}
+
+func TestMountWithContainedSymlinks(t *testing.T) {
+	t.Parallel()
+
+	th := NewTestHarness(t, afero.NewOsFs())
+	dir, _ := newTestSymlinkDir(t)
+
+	// Skip symlinks that escape the source by default.
+	m := th.NewMount(dir + ":/lib")
+	assert.Equal(t, []string{
+		"/lib/modules/git/a.tmpl",
+		"/lib/modules/git/b.tmpl",
+		"/lib/modules/scm/a.tmpl",
+		"/lib/modules/scm/b.tmpl",
+	}, mountFiles(t, m))
+
+	_, err := m.ReadFile("/lib/secret")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// Symlinks inside the source are followed.
+	m = th.NewMount(path.Join(dir, "modules") + ":/modules:symlinks=contain")
+	assert.Equal(t, []string{
+		"/modules/git/a.tmpl",
+		"/modules/git/b.tmpl",
+		"/modules/scm/a.tmpl",
+		"/modules/scm/b.tmpl",
+	}, mountFiles(t, m))
+}
+
+func TestMountWithExcludedSymlinks(t *testing.T) {
+	t.Parallel()
+
+	th := NewTestHarness(t, afero.NewOsFs())
+	dir, outside := newTestSymlinkDir(t)
+	require.NoError(t, os.Symlink(path.Join(outside, "secret"), path.Join(dir, "secret.bak")))
+	require.NoError(t, os.Symlink("loop.bak", path.Join(dir, "loop.bak")))
+	th.WriteFileString(path.Join(dir, ignoreFilename), "secret\n")
+
+	// Check that filtered symlinks are skipped before they are resolved.
+	for _, policy := range []string{symlinksContain, symlinksFollow} {
+		m := th.NewMount(dir + ":/lib:symlinks=" + policy + ",exclude=**/*.bak")
+		assert.Equal(t, []string{
+			"/lib/modules/git/a.tmpl",
+			"/lib/modules/git/b.tmpl",
+			"/lib/modules/scm/a.tmpl",
+			"/lib/modules/scm/b.tmpl",
+		}, mountFiles(t, m), policy)
+	}
+}
+
+func TestMountWithInvalidSymlinksOption(t *testing.T) {
+	t.Parallel()
+
+	th := NewTestHarness(t, afero.NewMemMapFs())
+	err := th.NewMountExpectingError(th.TempDir() + ":/lib:symlinks=ignore")
+	assert.ErrorIs(t, err, ErrMountInvalid)
 }
@@ -2,6 +2,7 @@ package internal
 
 import (
 	"errors"
+	"fmt"
 	"os"
 	"slices"
 
@@ -15,7 +16,9 @@ func NewMounts(fs afero.Fs, specs []string) (Mounts, error) {
 	var mounts Mounts
 	for _, spec := range specs {
 		mount, err := NewMount(fs, spec)
-		if err != nil {
+		if errors.Is(err, ErrMountSkipped) {
+			continue
+		} else if err != nil {
 			return nil, err
 		}
 
@@ -25,16 +28,53 @@ func NewMounts(fs afero.Fs, specs []string) (Mounts, error) {
 	// Since the ealier mounts should take precedence over later mounts,
 	// reverse the mounts.
 	slices.Reverse(mounts)
+
+	// Add the built-in library with the lowest precedence.
+	std, err := newStdMount()
+	if err != nil {
+		return nil, err
+	}
+	mounts = append(mounts, std)
+
 	return mounts, nil
 }
 
-func (m Mounts) Directories(pattern string) ([]string, error) {
+func (m Mounts) GitRevisions() []GitRevision {
+	// List the revisions in the order of the mount specs.
+	var revisions []GitRevision
+	for i := len(m) - 1; i >= 0; i-- {
+		if m[i].revision != nil {
+			revisions = append(revisions, *m[i].revision)
+		}
+	}
+
+	return revisions
+}
+
+func (m Mounts) std() Mounts {
+	// Find the built-in library.
+	var std Mounts
+	for _, mount := range m {
+		if mount.std {
+			std = append(std, mount)
+		}
+	}
+
+	return std
+}
+
+func (m Mounts) Directories(patterns ...string) ([]string, error) {
+	glob, err := NewGlob(patterns...)
+	if err != nil {
+		return nil, err
+	}
+
 	// Iterate over the mounts and list the directories. The mounts ealier in the
 	// list take precedence over the mounts later in the list.
 	var directories []string
 	var excludeFns []func(string) bool
 	for _, mount := range m {
-		err := mount.Dirs(pattern, &directories, excludeFns)
+		err := mount.dirs(glob, &directories, excludeFns)
 		if err != nil {
 			return nil, err
 		}
@@ -46,6 +86,13 @@ func (m Mounts) Directories(pattern string) ([]string, error) {
 		} else {
 			excludeFns = append(excludeFns, excludeExactly(mount.targetPath))
 		}
+
+		// Hide the paths of the whiteouts from the lower mounts.
+		hiddenFns, err := mount.excludeHidden(glob)
+		if err != nil {
+			return nil, err
+		}
+		excludeFns = append(excludeFns, hiddenFns...)
 	}
 
 	// Sort the directories if more than one mount to maintain predictable
@@ -57,13 +104,18 @@ func (m Mounts) Directories(pattern string) ([]string, error) {
 	return directories, nil
 }
 
-func (m Mounts) Files(pattern string) ([]string, error) {
+func (m Mounts) Files(patterns ...string) ([]string, error) {
+	glob, err := NewGlob(patterns...)
+	if err != nil {
+		return nil, err
+	}
+
 	// Iterate over the mounts and list the files. The mounts ealier in the list
 	// take precedence over the mounts later in the list.
 	var files []string
 	var excludeFns []func(string) bool
 	for _, mount := range m {
-		err := mount.Files(pattern, &files, excludeFns)
+		err := mount.files(glob, &files, excludeFns)
 		if err != nil {
 			return nil, err
 		}
@@ -75,6 +127,13 @@ func (m Mounts) Files(pattern string) ([]string, error) {
 		} else {
 			excludeFns = append(excludeFns, excludeExactly(mount.targetPath))
 		}
+
+		// Hide the paths of the whiteouts from the lower mounts.
+		hiddenFns, err := mount.excludeHidden(glob)
+		if err != nil {
+			return nil, err
+		}
+		excludeFns = append(excludeFns, hiddenFns...)
 	}
 
 	// Sort the files if more than one mount to maintain predictable results
@@ -86,12 +145,75 @@ func (m Mounts) Files(pattern string) ([]string, error) {
 	return files, nil
 }
 
-func (m Mounts) ReadFileString(targetPath string) (string, error) {
+func (m Mounts) ReadFile(targetPath string) ([]byte, error) {
 	// Iterate over the mounts and read the file. The mounts ealier in the list
 	// take precedence over the mounts later in the list.
 	for _, mount := range m {
-		s, err := mount.ReadFileString(targetPath)
+		b, err := mount.ReadFile(targetPath)
+		if errors.Is(err, os.ErrNotExist) {
+			// Stop at a whiteout that hides the file from the lower mounts.
+			if hidden, err := mount.hides(targetPath); err != nil {
+				return nil, err
+			} else if hidden {
+				break
+			}
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		return b, nil
+	}
+
+	// File not found.
+	return nil, os.ErrNotExist
+}
+
+func (m Mounts) ReadFileString(targetPath string) (string, error) {
+	b, err := m.ReadFile(targetPath)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+func (m Mounts) Stat(targetPath string) (*FileInfo, error) {
+	// Iterate over the mounts and stat the path. The mounts ealier in the list
+	// take precedence over the mounts later in the list.
+	for _, mount := range m {
+		info, err := mount.Stat(targetPath)
+		if errors.Is(err, os.ErrNotExist) {
+			// Stop at a whiteout that hides the path from the lower mounts.
+			if hidden, err := mount.hides(targetPath); err != nil {
+				return nil, err
+			} else if hidden {
+				break
+			}
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		return info, nil
+	}
+
+	// File not found.
+	return nil, fmt.Errorf("%w: %s", os.ErrNotExist, targetPath)
+}
+
+func (m Mounts) Readlink(targetPath string) (string, error) {
+	// Iterate over the mounts and read the symlink. The mounts ealier in the
+	// list take precedence over the mounts later in the list.
+	for _, mount := range m {
+		s, err := mount.Readlink(targetPath)
 		if errors.Is(err, os.ErrNotExist) {
+			// Stop at a whiteout that hides the path from the lower mounts.
+			if hidden, err := mount.hides(targetPath); err != nil {
+				return "", err
+			} else if hidden {
+				break
+			}
 			continue
 		} else if err != nil {
 			return "", err
@@ -101,5 +223,5 @@ func (m Mounts) ReadFileString(targetPath string) (string, error) {
 	}
 
 	// File not found.
-	return "", os.ErrNotExist
+	return "", fmt.Errorf("%w: %s", os.ErrNotExist, targetPath)
 }
@@ -1,11 +1,13 @@
 package internal
 
 import (
+	"os"
 	"path"
 	"testing"
 
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestMountsFiles(t *testing.T) {
@@ -53,3 +55,140 @@ func TestMountsFiles(t *testing.T) {
 		"/target/0/2",
 	})
 }
+
+func TestMountsWithWhiteouts(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+	th := NewTestHarness(t, fs)
+
+	dir1 := th.TempDir()
+	th.WriteFileString(path.Join(dir1, "includes", "en.tmpl"), "en")
+	th.WriteFileString(path.Join(dir1, "includes", "fr.tmpl"), "fr")
+	th.WriteFileString(path.Join(dir1, "includes", "de", "a.tmpl"), "a")
+	th.WriteFileString(path.Join(dir1, "includes", "es", "a.tmpl"), "a")
+
+	dir2 := th.TempDir()
+	th.WriteFileString(path.Join(dir2, "en.tmpl"), "en2")
+	th.WriteFileString(path.Join(dir2, ".wh.fr.tmpl"), "")
+	th.WriteFileString(path.Join(dir2, ".wh.de"), "")
+
+	dir3 := th.TempDir()
+	th.WriteFileString(path.Join(dir3, ".wh.es"), "")
+
+	mounts := th.NewMounts(
+		dir1+":/",
+		dir2+":/includes",
+		path.Join(dir3, ".wh.es")+":/includes/.wh.es",
+	)
+
+	// Check that the whiteouts hide files and directories in the lower mounts.
+	files, err := mounts.Files("/includes/**")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/includes/en.tmpl"}, files)
+
+	dirs, err := mounts.Directories("/includes/*")
+	require.NoError(t, err)
+	assert.Empty(t, dirs)
+
+	s, err := mounts.ReadFileString("/includes/en.tmpl")
+	require.NoError(t, err)
+	assert.Equal(t, "en2", s)
+
+	for _, p := range []string{
+		"/includes/fr.tmpl",
+		"/includes/de/a.tmpl",
+		"/includes/es/a.tmpl",
+		"/includes/.wh.fr.tmpl",
+		"/includes/.wh.es",
+	} {
+		_, err = mounts.ReadFileString(p)
+		assert.ErrorIs(t, err, os.ErrNotExist, p)
+
+		_, err = mounts.Stat(p)
+		assert.ErrorIs(t, err, os.ErrNotExist, p)
+	}
+
+	_, err = mounts.Stat("/includes/es")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestMountsWithWhiteoutsInRootMount(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+	th := NewTestHarness(t, fs)
+
+	lower := th.TempDir()
+	th.WriteFileString(path.Join(lower, "en.tmpl"), "en")
+	th.WriteFileString(path.Join(lower, "fr.tmpl"), "fr")
+	th.WriteFileString(path.Join(lower, "de", "a.tmpl"), "a")
+	th.WriteFileString(path.Join(lower, "es", "a.tmpl"), "a")
+
+	upper := th.TempDir()
+	th.WriteFileString(path.Join(upper, "includes", ".wh.fr.tmpl"), "")
+	th.WriteFileString(path.Join(upper, "includes", ".wh.de"), "")
+
+	// Check that listings of the lower mount agree with the reads, since the
+	// root mount does not replace the listings of /includes.
+	mounts := th.NewMounts(lower+":/includes", upper+"/:/")
+	files, err := mounts.Files("/includes/**")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/includes/en.tmpl", "/includes/es/a.tmpl"}, files)
+
+	dirs, err := mounts.Directories("/includes/*")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/includes/es"}, dirs)
+
+	for _, p := range []string{"/includes/fr.tmpl", "/includes/de/a.tmpl"} {
+		_, err = mounts.ReadFile(p)
+		assert.ErrorIs(t, err, os.ErrNotExist, p)
+	}
+}
+
+func TestMountsWithWhiteoutFile(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+	th := NewTestHarness(t, fs)
+
+	dir1 := th.TempDir()
+	th.WriteFileString(path.Join(dir1, "en.tmpl"), "en")
+	th.WriteFileString(path.Join(dir1, "fr.tmpl"), "fr")
+	th.WriteFileString(path.Join(dir1, "fr", "a.tmpl"), "a")
+
+	dir2 := th.TempDir()
+	th.WriteFileString(path.Join(dir2, "empty"), "")
+
+	// Check that a whiteout only hides the lower mounts.
+	mounts := th.NewMounts(path.Join(dir2, "empty")+":/includes/.wh.fr.tmpl", dir1+":/includes")
+	files, err := mounts.Files("/includes/**")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/includes/en.tmpl", "/includes/fr.tmpl", "/includes/fr/a.tmpl"}, files)
+
+	// Check that a mounted whiteout file hides the path and nothing else.
+	mounts = th.NewMounts(dir1+":/includes", path.Join(dir2, "empty")+":/includes/.wh.fr.tmpl")
+	files, err = mounts.Files("/includes/**")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/includes/en.tmpl", "/includes/fr/a.tmpl"}, files)
+
+	dirs, err := mounts.Directories("/includes/**")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/includes", "/includes/fr"}, dirs)
+
+	// Check that a mounted whiteout file hides a directory of a lower mount.
+	mounts = th.NewMounts(dir1+":/includes", path.Join(dir2, "empty")+":/includes/.wh.fr")
+	files, err = mounts.Files("/includes/**")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/includes/en.tmpl", "/includes/fr.tmpl"}, files)
+
+	dirs, err = mounts.Directories("/includes/**")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/includes"}, dirs)
+
+	_, err = mounts.Stat("/includes/fr")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	_, err = mounts.ReadFile("/includes/fr/a.tmpl")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
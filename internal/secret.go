@@ -0,0 +1,221 @@
+package internal
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v3"
+)
+
+const secretAlgorithm = "AES256_GCM"
+
+const secretKeySize = 32
+
+const secretTag = "!secret"
+
+const redacted = "[REDACTED]"
+
+func GenerateSecretKey() (string, error) {
+	key := make([]byte, secretKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+func ReadSecretKey(fs afero.Fs, name string) ([]byte, error) {
+	b, err := afero.ReadFile(fs, name)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil || len(key) != secretKeySize {
+		return nil, fmt.Errorf("%w: %s: expected %d base64 encoded bytes", ErrSecretKeyInvalid, name, secretKeySize)
+	}
+
+	return key, nil
+}
+
+func EncryptSecret(key []byte, plaintext string) (string, error) {
+	aead, err := newSecretCipher(key)
+	if err != nil {
+		return "", err
+	}
+
+	// Prefix the ciphertext with a random nonce.
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), nil)
+
+	return "ENC[" + secretAlgorithm + "," + base64.StdEncoding.EncodeToString(sealed) + "]", nil
+}
+
+func DecryptSecret(key []byte, value string) (string, error) {
+	// The envelope is optional when the value is tagged as a secret.
+	payload := strings.TrimSpace(value)
+	if isSecretEnvelope(payload) {
+		payload = payload[len("ENC[") : len(payload)-1]
+	}
+
+	// Check the algorithm.
+	algorithm, encoded, ok := strings.Cut(payload, ",")
+	if !ok || algorithm != secretAlgorithm {
+		return "", fmt.Errorf("%w: expected '%s' envelope", ErrSecretInvalid, secretAlgorithm)
+	}
+
+	// Decode the nonce and ciphertext.
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrSecretInvalid, err)
+	}
+
+	aead, err := newSecretCipher(key)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("%w: value too short", ErrSecretInvalid)
+	}
+
+	// Decrypt the value.
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("%w: decryption failed", ErrSecretInvalid)
+	}
+
+	return string(plaintext), nil
+}
+
+func newSecretCipher(key []byte) (cipher.AEAD, error) {
+	if len(key) != secretKeySize {
+		return nil, fmt.Errorf("%w: expected %d bytes", ErrSecretKeyInvalid, secretKeySize)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func isSecretEnvelope(s string) bool {
+	return strings.HasPrefix(s, "ENC[") && strings.HasSuffix(s, "]")
+}
+
+func (c *ConfigSpec) decryptSecrets(node *yaml.Node) error {
+	// Decrypt scalars tagged as secrets or wrapped in an envelope.
+	if node.Kind == yaml.ScalarNode {
+		tagged := node.Tag == secretTag
+		if !tagged && (node.ShortTag() != "!!str" || !isSecretEnvelope(node.Value)) {
+			return nil
+		}
+
+		// Load the key the first time that it is needed.
+		if c.secretKey == nil {
+			if c.options.SecretKeyFile == "" {
+				return fmt.Errorf("%w: encrypted value at line %d", ErrSecretKeyRequired, node.Line)
+			}
+
+			key, err := ReadSecretKey(c.fs, c.options.SecretKeyFile)
+			if err != nil {
+				return err
+			}
+			c.secretKey = key
+		}
+
+		plaintext, err := DecryptSecret(c.secretKey, node.Value)
+		if err != nil {
+			return fmt.Errorf("%w at line %d", err, node.Line)
+		}
+
+		// Replace the node with the plain text value and remember the value
+		// so that it can be redacted.
+		setStringNode(node, plaintext)
+		if plaintext != "" && !slices.Contains(c.secrets, plaintext) {
+			c.secrets = append(c.secrets, plaintext)
+		}
+		return nil
+	}
+
+	// Decrypt the children.
+	for _, child := range node.Content {
+		if err := c.decryptSecrets(child); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *ConfigSpec) Redact(s string) string {
+	// Replace longer secrets first in case one secret contains another.
+	secrets := slices.Clone(c.secrets)
+	slices.SortFunc(secrets, func(a, b string) int {
+		return len(b) - len(a)
+	})
+
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+
+	return s
+}
+
+func (c *ConfigSpec) RedactError(err error) error {
+	if err == nil || len(c.secrets) == 0 {
+		return err
+	}
+
+	msg := c.Redact(err.Error())
+	if msg == err.Error() {
+		return err
+	}
+
+	return &redactedError{err, msg}
+}
+
+func (c *ConfigSpec) redactValue(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(t))
+		for k, child := range t {
+			out[k] = c.redactValue(child)
+		}
+		return out
+	case []any:
+		out := make([]any, len(t))
+		for i, child := range t {
+			out[i] = c.redactValue(child)
+		}
+		return out
+	case string:
+		return c.Redact(t)
+	default:
+		return v
+	}
+}
+
+type redactedError struct {
+	err error
+	msg string
+}
+
+func (e *redactedError) Error() string {
+	return e.msg
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,47 @@
+package internal
+
+import (
+	"embed"
+	"io/fs"
+	"path"
+
+	"github.com/spf13/afero"
+)
+
+//go:embed std
+var stdFiles embed.FS
+
+const stdTargetPath = "/std"
+
+func newStdMount() (*Mount, error) {
+	// Copy the embedded files into memory to mount them like a directory.
+	stdFs := afero.NewMemMapFs()
+	err := fs.WalkDir(stdFiles, "std", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		targetPath := path.Join("/", p)
+		if d.IsDir() {
+			return stdFs.MkdirAll(targetPath, 0755)
+		}
+
+		b, err := stdFiles.ReadFile(p)
+		if err != nil {
+			return err
+		}
+
+		return afero.WriteFile(stdFs, targetPath, b, 0644)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	mount, err := NewMount(stdFs, stdTargetPath+":"+stdTargetPath)
+	if err != nil {
+		return nil, err
+	}
+
+	mount.std = true
+	return mount, nil
+}
@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"path"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStdMount(t *testing.T) {
+	t.Parallel()
+
+	th := NewTestHarness(t, afero.NewMemMapFs())
+	mounts := th.NewMounts()
+
+	files, err := mounts.Files("/std/license/*")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/std/license/apache-2.0.tmpl", "/std/license/mit.tmpl"}, files)
+
+	dirs, err := mounts.Directories("/std/*")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/std/dockerfile", "/std/license"}, dirs)
+}
+
+func TestStdMountWhenPatternOutsideStd(t *testing.T) {
+	t.Parallel()
+
+	th := NewTestHarness(t, afero.NewMemMapFs())
+	dir := th.TempDir()
+	th.WriteFileString(path.Join(dir, "main.tmpl"), "")
+	mounts := th.NewMounts(dir + ":/site")
+
+	// Patterns must start inside /std to match the library.
+	files, err := mounts.Files("/**/*.tmpl")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/site/main.tmpl"}, files)
+
+	dirs, err := mounts.Directories("/**")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/site"}, dirs)
+
+	files, err = mounts.Files("/std/**/mit.tmpl")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/std/license/mit.tmpl"}, files)
+}
+
+func TestExecuteWhenStd(t *testing.T) {
+	t.Parallel()
+
+	th := NewTestHarness(t, afero.NewMemMapFs())
+	dir := th.TempDir()
+	th.WriteFileString(path.Join(dir, "Dockerfile.tmpl"), `{{ include "/std/license/mit.tmpl" (dict "Year" 2024 "Holder" "Example") }}
+FROM debian
+{{ include "/std/dockerfile/user.dockerfile.tmpl" (dict "UID" 1001) }}
+{{ include "/std/dockerfile/healthcheck.dockerfile.tmpl" (dict "Command" "curl -f http://localhost/") }}`)
+
+	outFilename := path.Join(th.TempDir(), "out")
+	s, _ := th.ExecuteString("/Dockerfile.tmpl", []string{path.Join(dir, "Dockerfile.tmpl") + ":/Dockerfile.tmpl"}, nil, outFilename, DefaultOptions())
+	assert.Equal(t, `# Copyright (c) 2024 Example
+#
+# Licensed under the MIT License. See the LICENSE file in the project root
+# for the full license text.
+#
+# SPDX-License-Identifier: MIT
+FROM debian
+RUN groupadd --gid 1001 app \
+    && useradd --uid 1001 --gid 1001 --create-home --shell /bin/sh app
+USER app
+HEALTHCHECK --interval=30s --timeout=5s --retries=3 \
+    CMD curl -f http://localhost/`, s)
+}
+
+func TestExecuteWhenStdOverridden(t *testing.T) {
+	t.Parallel()
+
+	th := NewTestHarness(t, afero.NewMemMapFs())
+	dir := th.TempDir()
+	th.WriteFileString(path.Join(dir, "main.tmpl"), `{{ include "/std/license/mit.tmpl" . }}|{{ includeText "/std/VERSION" | trim }}`)
+	th.WriteFileString(path.Join(dir, "mit.tmpl"), "Custom license")
+
+	outFilename := path.Join(th.TempDir(), "out")
+	s, _ := th.ExecuteString("/main.tmpl", []string{
+		path.Join(dir, "main.tmpl") + ":/main.tmpl",
+		path.Join(dir, "mit.tmpl") + ":/std/license/mit.tmpl",
+	}, nil, outFilename, DefaultOptions())
+	assert.Equal(t, "Custom license|1.0.0", s)
+}
@@ -2,8 +2,11 @@ package internal
 
 import (
 	"io"
+	"path"
 	"strings"
 	"text/template"
+
+	"github.com/Masterminds/sprig/v3"
 )
 
 type Template struct {
@@ -11,6 +14,10 @@ type Template struct {
 	cache *TemplateCache
 }
 
+func newTemplate(name string, opts Options) *template.Template {
+	return template.New(name).Option("missingkey=" + opts.MissingKey).Funcs(sprig.FuncMap()).Funcs(DummyFunctions.FuncMap())
+}
+
 func NewTemplate(
 	t *template.Template,
 	cache *TemplateCache,
@@ -28,6 +35,12 @@ func (t *Template) Execute(wr io.Writer, mounts Mounts, data any) error {
 	funcs := NewFunctions(filename, mounts, t.cache)
 	cloned.Funcs(funcs.FuncMap())
 
+	// Apply the config files of the template's directories.
+	data, err = t.cache.directoryData(path.Dir(filename), data)
+	if err != nil {
+		return err
+	}
+
 	return cloned.Execute(wr, data)
 }
 
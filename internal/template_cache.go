@@ -5,23 +5,60 @@ import (
 	"path"
 	"sync"
 	"text/template"
-
-	"github.com/Masterminds/sprig/v3"
 )
 
 type TemplateCache struct {
-	mounts    Mounts
-	options   Options
-	templates map[string]*template.Template
-	mutex     sync.RWMutex
+	mounts          Mounts
+	configSpec      *ConfigSpec
+	options         Options
+	templates       map[string]*template.Template
+	mutex           sync.RWMutex
+	configs         map[string]map[string]any
+	defaulted       map[uintptr]defaultedData
+	configMutex     sync.Mutex
+	dependencies    map[string]bool
+	dependencyMutex sync.Mutex
 }
 
 func NewTemplateCache(mounts Mounts, opts Options) *TemplateCache {
 	return &TemplateCache{
-		mounts:    mounts,
-		options:   opts,
-		templates: make(map[string]*template.Template),
+		mounts:       mounts,
+		options:      opts,
+		templates:    make(map[string]*template.Template),
+		configs:      make(map[string]map[string]any),
+		defaulted:    make(map[uintptr]defaultedData),
+		dependencies: make(map[string]bool),
+	}
+}
+
+func (cache *TemplateCache) recordDependency(name string) {
+	cache.dependencyMutex.Lock()
+	defer cache.dependencyMutex.Unlock()
+
+	cache.dependencies[name] = true
+}
+
+func (cache *TemplateCache) readFile(name string) ([]byte, error) {
+	b, err := cache.mounts.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check the file against the lockfile.
+	if err := cache.options.Lock.verify(name, b); err != nil {
+		return nil, err
 	}
+
+	cache.recordDependency(name)
+	return b, nil
+}
+
+func (cache *TemplateCache) Dependencies() []string {
+	cache.dependencyMutex.Lock()
+	defer cache.dependencyMutex.Unlock()
+
+	// List the files read through the mounts in order.
+	return sortedKeys(cache.dependencies)
 }
 
 func (cache *TemplateCache) Template(name string) (*Template, error) {
@@ -50,13 +87,13 @@ func (cache *TemplateCache) Template(name string) (*Template, error) {
 		t := cache.templates[name]
 		if t == nil {
 			// Read the template from the mounts.
-			s, err := cache.mounts.ReadFileString(name)
+			b, err := cache.readFile(name)
 			if err != nil {
 				return nil, err
 			}
 
 			// Create and parse the template.
-			t, err = template.New(name).Option("missingkey=" + cache.options.MissingKey).Funcs(sprig.FuncMap()).Funcs(DummyFunctions.FuncMap()).Parse(s)
+			t, err = newTemplate(name, cache.options).Parse(string(b))
 			if err != nil {
 				return nil, err
 			}
@@ -22,7 +22,11 @@ func NewTestHarness(t *testing.T, fs afero.Fs) *TestHarness {
 //-----------------------------------------------------------------------------
 
 func (th *TestHarness) NewConfigSpec(names ...string) *ConfigSpec {
-	configSpec, err := NewConfigSpec(th.fs, names)
+	return th.NewConfigSpecWithOptions(DefaultOptions(), names...)
+}
+
+func (th *TestHarness) NewConfigSpecWithOptions(opts Options, names ...string) *ConfigSpec {
+	configSpec, err := NewConfigSpec(th.fs, nil, names, opts)
 	require.NoError(th.t, err)
 	require.NotNil(th.t, configSpec)
 	return configSpec
@@ -0,0 +1,77 @@
+package internal
+
+import (
+	"slices"
+	"strings"
+)
+
+const whiteoutPrefix = ".wh."
+
+func cutWhiteout(name string) (string, bool) {
+	// A whiteout file '.wh.<name>' hides '<name>' in the lower mounts.
+	hidden, ok := strings.CutPrefix(name, whiteoutPrefix)
+	return hidden, ok && hidden != ""
+}
+
+func (idx *mountIndex) hides(rel string) bool {
+	// Check for a whiteout of the path or one of its parent directories.
+	node := idx
+	for _, name := range strings.Split(rel, "/") {
+		if _, ok := slices.BinarySearch(node.whiteouts, name); ok {
+			return true
+		}
+
+		node = node.dirs[name]
+		if node == nil {
+			return false
+		}
+	}
+
+	return false
+}
+
+func (m *Mount) hides(targetPath string) (bool, error) {
+	// Check a mounted whiteout file.
+	if !m.directory {
+		_, ok := cutTargetPath(m.whiteout, targetPath)
+		return m.whiteout != "" && ok, nil
+	}
+
+	// Look up whiteouts of directories in the index.
+	rel, ok := cutTargetPath(m.targetPath, targetPath)
+	if !ok || rel == "" {
+		return false, nil
+	}
+
+	index, err := m.loadIndex()
+	if err != nil {
+		return false, err
+	}
+
+	return index.hides(rel), nil
+}
+
+func (m *Mount) excludeHidden(glob *Glob) ([]func(string) bool, error) {
+	// Check a mounted whiteout file.
+	if !m.directory {
+		if m.whiteout == "" {
+			return nil, nil
+		}
+		return []func(string) bool{excludeExactly(m.whiteout), excludePrefix(appendPathSeparator(m.whiteout))}, nil
+	}
+
+	// Only load the index when the patterns can match paths in the directory.
+	if len(searchRoots(m.targetPath, glob, false)) == 0 {
+		return nil, nil
+	}
+
+	index, err := m.loadIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	return []func(string) bool{func(p string) bool {
+		rel, ok := cutTargetPath(m.targetPath, p)
+		return ok && rel != "" && index.hides(rel)
+	}}, nil
+}
@@ -3,6 +3,7 @@ package main
 import (
 	_ "embed"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 
@@ -39,7 +40,47 @@ func newApp() *cli.App {
 				&cli.StringSliceFlag{
 					Name:    "config",
 					Aliases: []string{"c"},
-					Usage:   "Apply configuration data to the templates",
+					Usage:   "Apply configuration data to the templates (- reads from stdin)",
+				},
+				&cli.StringFlag{
+					Name:  "config-migrations",
+					Usage: "Rewrite renamed and removed configuration keys with the migrations in file, or the mounted file at the path",
+				},
+				&cli.StringSliceFlag{
+					Name:  "config-patch",
+					Usage: "Apply a JSON patch or merge patch to the merged configuration data",
+				},
+				&cli.StringSliceFlag{
+					Name:  "config-tags",
+					Usage: "Permit only the given custom YAML tags in configuration files (e.g. env,file)",
+				},
+				&cli.StringFlag{
+					Name:  "deps",
+					Usage: "Write the files read through the mounts to file, one per line",
+				},
+				&specsFlag{&cli.GenericFlag{
+					Name:  "inline",
+					Usage: "Attach a file with the given content to the template engine (e.g. /path=content)",
+					Value: &specList{},
+				}},
+				&specsFlag{&cli.GenericFlag{
+					Name:  "inline-file",
+					Usage: "Attach a file at the given path to the template engine (e.g. /path=file)",
+					Value: &specList{},
+				}},
+				&cli.StringFlag{
+					Name:    "lock-public-key",
+					Usage:   "Verify the signature of the lockfile with the ed25519 public key in file (implies --locked)",
+					EnvVars: []string{"TMPL_LOCK_PUBLIC_KEY_FILE"},
+				},
+				&cli.BoolFlag{
+					Name:  "locked",
+					Usage: "Fail if a file read through the mounts differs from the lockfile",
+				},
+				&cli.StringFlag{
+					Name:  "lockfile",
+					Usage: "Check the files read through the mounts with the lockfile",
+					Value: "tmpl.lock",
 				},
 				&cli.StringFlag{
 					Name:        "missingkey",
@@ -47,16 +88,31 @@ func newApp() *cli.App {
 					DefaultText: "error",
 					Value:       "error",
 				},
-				&cli.StringSliceFlag{
+				&specsFlag{&cli.GenericFlag{
 					Name:    "mount",
 					Aliases: []string{"m"},
 					Usage:   "Attach a filesystem mount to the template engine",
+					Value:   &specList{},
+				}},
+				&cli.StringSliceFlag{
+					Name:    "profile",
+					Aliases: []string{"p"},
+					Usage:   "Apply the named profile from the configuration files",
 				},
 				&cli.StringFlag{
 					Name:    "out",
 					Aliases: []string{"o"},
 					Usage:   "Write the generated text to file",
 				},
+				&cli.StringFlag{
+					Name:    "secret-key",
+					Usage:   "Decrypt secret configuration values with the key in file",
+					EnvVars: []string{"TMPL_SECRET_KEY_FILE"},
+				},
+				&cli.BoolFlag{
+					Name:  "strict-config",
+					Usage: "Fail on type conflicts and ambiguous values in configuration files",
+				},
 			},
 			Action: func(c *cli.Context) error {
 				// Check for the out flag.
@@ -71,18 +127,48 @@ func newApp() *cli.App {
 
 				// Collect the options.
 				opts := internal.Options{
-					MissingKey: c.String("missingkey"),
+					MissingKey:       c.String("missingkey"),
+					ConfigMigrations: c.String("config-migrations"),
+					ConfigPatches:    c.StringSlice("config-patch"),
+					ConfigTags:       configTags(c),
+					Inline:           specSlice(c, "inline"),
+					InlineFiles:      specSlice(c, "inline-file"),
+					Profiles:         c.StringSlice("profile"),
+					SecretKeyFile:    c.String("secret-key"),
+					StrictConfig:     c.Bool("strict-config"),
 				}
 
-				// Execute the template.
+				// Load the lockfile to check the files read through the mounts. A
+				// public key implies that the lockfile is used.
 				fs := afero.NewOsFs()
+				if c.Bool("locked") || c.String("lock-public-key") != "" {
+					lock, err := internal.LoadLock(fs, c.String("lockfile"), c.String("lock-public-key"))
+					exitIfError(err)
+					opts.Lock = lock
+				}
+
+				// Execute the template.
 				templateFilename := c.Args().First()
-				mountSpecs := c.StringSlice("mount")
+				mountSpecs := specSlice(c, "mount")
 				configFilenames := c.StringSlice("config")
 				outFilename := c.String("out")
 				result, err := internal.Execute(fs, templateFilename, mountSpecs, configFilenames, outFilename, opts)
 				exitIfError(err)
 
+				// Write the dependencies, if requested.
+				if c.IsSet("deps") {
+					err := internal.WriteDependencies(fs, c.String("deps"), result.Dependencies)
+					exitIfError(err)
+				}
+
+				// Print the warnings.
+				printWarnings(result.Warnings)
+
+				// Print the git revisions that were mounted.
+				for _, revision := range result.GitRevisions {
+					fmt.Printf("Mounted %s@%s (%s)\n", revision.Repository, revision.Revision, revision.Commit)
+				}
+
 				// Print the results.
 				fmt.Printf("Generated %d file(s) in %s\n", len(result.Filenames), result.Duration)
 				for _, filename := range result.Filenames {
@@ -93,6 +179,265 @@ func newApp() *cli.App {
 				return nil
 			},
 		},
+		{
+			Name:  "config",
+			Usage: "Inspect and edit configuration files",
+			Subcommands: []*cli.Command{
+				{
+					Name:      "set",
+					Usage:     "Set a value in a configuration file, preserving comments and formatting",
+					ArgsUsage: "file key value",
+					Action: func(c *cli.Context) error {
+						// Check for exactly three arguments.
+						if c.NArg() != 3 {
+							exitWithMessage("Error: Exactly three arguments are required.")
+						}
+
+						// Set the value.
+						fs := afero.NewOsFs()
+						err := internal.SetConfigValue(fs, c.Args().Get(0), c.Args().Get(1), c.Args().Get(2))
+						exitIfError(err)
+
+						// Success.
+						return nil
+					},
+				},
+				{
+					Name:      "unset",
+					Usage:     "Remove a value from a configuration file, preserving comments and formatting",
+					ArgsUsage: "file key",
+					Action: func(c *cli.Context) error {
+						// Check for exactly two arguments.
+						if c.NArg() != 2 {
+							exitWithMessage("Error: Exactly two arguments are required.")
+						}
+
+						// Remove the value.
+						fs := afero.NewOsFs()
+						err := internal.UnsetConfigValue(fs, c.Args().Get(0), c.Args().Get(1))
+						exitIfError(err)
+
+						// Success.
+						return nil
+					},
+				},
+				{
+					Name:      "migrate",
+					Usage:     "Rewrite renamed and removed keys in configuration files, preserving comments and formatting",
+					ArgsUsage: "file...",
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:  "migrations",
+							Usage: "Apply the migrations in file, or the mounted file at the path",
+						},
+						&specsFlag{&cli.GenericFlag{
+							Name:    "mount",
+							Aliases: []string{"m"},
+							Usage:   "Attach a filesystem mount that can provide the migrations",
+							Value:   &specList{},
+						}},
+					},
+					Action: func(c *cli.Context) error {
+						// Check for at least one argument.
+						if c.NArg() == 0 {
+							exitWithMessage("Error: At least one argument is required.")
+						}
+
+						// Load the migrations, which a mounted library can provide.
+						fs := afero.NewOsFs()
+						mounts, err := internal.NewMounts(fs, specSlice(c, "mount"))
+						exitIfError(err)
+						migrations, err := internal.LoadMountedConfigMigrations(fs, mounts, c.String("migrations"), nil)
+						exitIfError(err)
+						if migrations == nil {
+							exitWithMessage("Error: The --migrations flag is required when no migrations file is mounted.")
+						}
+
+						// Migrate the files and print the changes.
+						for _, name := range c.Args().Slice() {
+							changes, err := internal.MigrateConfigFile(fs, name, migrations)
+							exitIfError(err)
+
+							for _, change := range changes {
+								fmt.Println(change)
+							}
+						}
+
+						// Success.
+						return nil
+					},
+				},
+				{
+					Name:  "explain",
+					Usage: "Print each merged configuration value and the files that set it",
+					Flags: []cli.Flag{
+						&cli.StringSliceFlag{
+							Name:    "config",
+							Aliases: []string{"c"},
+							Usage:   "Apply configuration data to the templates (- reads from stdin)",
+						},
+						&cli.StringFlag{
+							Name:  "config-migrations",
+							Usage: "Rewrite renamed and removed configuration keys with the migrations in file, or the mounted file at the path",
+						},
+						&cli.StringSliceFlag{
+							Name:  "config-patch",
+							Usage: "Apply a JSON patch or merge patch to the merged configuration data",
+						},
+						&cli.StringSliceFlag{
+							Name:  "config-tags",
+							Usage: "Permit only the given custom YAML tags in configuration files (e.g. env,file)",
+						},
+						&specsFlag{&cli.GenericFlag{
+							Name:    "mount",
+							Aliases: []string{"m"},
+							Usage:   "Attach a filesystem mount to configuration templates",
+							Value:   &specList{},
+						}},
+						&cli.StringSliceFlag{
+							Name:    "profile",
+							Aliases: []string{"p"},
+							Usage:   "Apply the named profile from the configuration files",
+						},
+						&cli.StringFlag{
+							Name:    "secret-key",
+							Usage:   "Decrypt secret configuration values with the key in file",
+							EnvVars: []string{"TMPL_SECRET_KEY_FILE"},
+						},
+						&cli.BoolFlag{
+							Name:  "strict-config",
+							Usage: "Fail on type conflicts and ambiguous values in configuration files",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						// Collect the options.
+						opts := internal.DefaultOptions()
+						opts.ConfigMigrations = c.String("config-migrations")
+						opts.ConfigPatches = c.StringSlice("config-patch")
+						opts.ConfigTags = configTags(c)
+						opts.Profiles = c.StringSlice("profile")
+						opts.SecretKeyFile = c.String("secret-key")
+						opts.StrictConfig = c.Bool("strict-config")
+
+						// Create the mounts for config templates.
+						fs := afero.NewOsFs()
+						mounts, err := internal.NewMounts(fs, specSlice(c, "mount"))
+						exitIfError(err)
+
+						// Load the config files.
+						configSpec, err := internal.NewConfigSpec(fs, mounts, c.StringSlice("config"), opts)
+						exitIfError(err)
+
+						// Print the warnings.
+						printWarnings(configSpec.Warnings())
+
+						// Print the sources.
+						for _, source := range configSpec.Sources() {
+							fmt.Println(source)
+						}
+
+						// Success.
+						return nil
+					},
+				},
+			},
+		},
+		{
+			Name:  "lock",
+			Usage: "Write a lockfile with the checksums of the files reachable through the mounts",
+			Flags: []cli.Flag{
+				&specsFlag{&cli.GenericFlag{
+					Name:    "mount",
+					Aliases: []string{"m"},
+					Usage:   "Attach a filesystem mount to lock",
+					Value:   &specList{},
+				}},
+				&cli.StringFlag{
+					Name:    "out",
+					Aliases: []string{"o"},
+					Usage:   "Write the lockfile to file",
+					Value:   "tmpl.lock",
+				},
+				&cli.StringFlag{
+					Name:    "sign-key",
+					Usage:   "Sign the lockfile with the ed25519 private key in file",
+					EnvVars: []string{"TMPL_LOCK_SIGN_KEY_FILE"},
+				},
+			},
+			Action: func(c *cli.Context) error {
+				// Create the mounts.
+				fs := afero.NewOsFs()
+				mounts, err := internal.NewMounts(fs, specSlice(c, "mount"))
+				exitIfError(err)
+
+				// Hash the files and write the lockfile.
+				lock, err := internal.NewLock(mounts)
+				exitIfError(err)
+				err = internal.WriteLock(fs, c.String("out"), lock, c.String("sign-key"))
+				exitIfError(err)
+
+				// Print the lockfile.
+				fmt.Println(c.String("out"))
+				return nil
+			},
+		},
+		{
+			Name:  "secret",
+			Usage: "Manage encrypted configuration values",
+			Subcommands: []*cli.Command{
+				{
+					Name:  "keygen",
+					Usage: "Print a new secret key",
+					Action: func(c *cli.Context) error {
+						// Generate the key.
+						key, err := internal.GenerateSecretKey()
+						exitIfError(err)
+
+						// Print the key.
+						fmt.Println(key)
+						return nil
+					},
+				},
+				{
+					Name:      "encrypt",
+					Usage:     "Encrypt a value for a configuration file",
+					ArgsUsage: "[value]",
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:     "key",
+							Usage:    "Encrypt with the secret key in file",
+							EnvVars:  []string{"TMPL_SECRET_KEY_FILE"},
+							Required: true,
+						},
+					},
+					Action: func(c *cli.Context) error {
+						// Check for at most one argument.
+						if c.NArg() > 1 {
+							exitWithMessage("Error: At most one argument is allowed.")
+						}
+
+						// Read the value from stdin when no argument is given.
+						value := c.Args().First()
+						if c.NArg() == 0 {
+							b, err := io.ReadAll(os.Stdin)
+							exitIfError(err)
+							value = strings.TrimSuffix(string(b), "\n")
+						}
+
+						// Encrypt the value.
+						fs := afero.NewOsFs()
+						key, err := internal.ReadSecretKey(fs, c.String("key"))
+						exitIfError(err)
+						encrypted, err := internal.EncryptSecret(key, value)
+						exitIfError(err)
+
+						// Print the encrypted value.
+						fmt.Println(encrypted)
+						return nil
+					},
+				},
+			},
+		},
 		{
 			Name:  "license",
 			Usage: "Prints the license",
@@ -119,7 +464,55 @@ func exitIfError(err error) {
 	}
 }
 
+func configTags(c *cli.Context) []string {
+	// All tags are permitted unless the flag is set.
+	if !c.IsSet("config-tags") {
+		return nil
+	}
+
+	return append([]string{}, c.StringSlice("config-tags")...)
+}
+
+func printWarnings(warnings []internal.ConfigWarning) {
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+}
+
 func exitWithMessage(msg string) {
 	fmt.Fprintln(os.Stderr, msg)
 	os.Exit(1)
 }
+
+// specsFlag is a repeatable flag that keeps commas in its values, e.g. to
+// separate the options of a mount.
+type specsFlag struct {
+	*cli.GenericFlag
+}
+
+func (f *specsFlag) IsSliceFlag() bool {
+	return true
+}
+
+func (f *specsFlag) String() string {
+	return cli.FlagStringer(f)
+}
+
+type specList []string
+
+func (l *specList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func (l *specList) String() string {
+	return strings.Join(*l, " ")
+}
+
+func specSlice(c *cli.Context, name string) []string {
+	if l, ok := c.Generic(name).(*specList); ok {
+		return *l
+	}
+
+	return nil
+}